@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+const schemaFileSuffix = "_openapi.json"
+
+func main() {
+	sourceDir := flag.String("source-dir", "", "api/openapi-spec/v3 folder of a Kubernetes source tree")
+	outputDir := flag.String("output-dir", "", "folder to write the trimmed, compressed schema files into")
+	flag.Parse()
+	if *sourceDir == "" || *outputDir == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	err := run(*sourceDir, *outputDir)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(sourceDir string, outputDir string) error {
+	entries, err := os.ReadDir(sourceDir)
+	if err != nil {
+		return err
+	}
+	err = os.RemoveAll(outputDir)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(outputDir, 0755)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasSuffix(name, schemaFileSuffix) {
+			continue
+		}
+		data, err := os.ReadFile(path.Join(sourceDir, name))
+		if err != nil {
+			return err
+		}
+		trimmed, err := trimDocument(data)
+		if err != nil {
+			return fmt.Errorf("unable to trim '%s': %w", name, err)
+		}
+		if trimmed == nil {
+			continue
+		}
+		compressed := bytes.Buffer{}
+		writer, err := gzip.NewWriterLevel(&compressed, gzip.BestCompression)
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(trimmed)
+		if err != nil {
+			return err
+		}
+		err = writer.Close()
+		if err != nil {
+			return err
+		}
+		err = os.WriteFile(path.Join(outputDir, name+".gz"), compressed.Bytes(), 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// trimDocument keeps only the component schemas of an OpenAPI document, without descriptions,
+// which is all that is needed to compute patch metadata.
+func trimDocument(data []byte) ([]byte, error) {
+	var doc map[string]any
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, err
+	}
+	components, ok := doc["components"].(map[string]any)
+	if !ok {
+		return nil, nil
+	}
+	schemas, ok := components["schemas"].(map[string]any)
+	if !ok || len(schemas) == 0 {
+		return nil, nil
+	}
+	trimmed := map[string]any{
+		"openapi": doc["openapi"],
+		"info":    doc["info"],
+		"paths":   map[string]any{},
+		"components": map[string]any{
+			"schemas": stripDescriptions(schemas),
+		},
+	}
+	return json.Marshal(trimmed)
+}
+
+func stripDescriptions(v any) any {
+	switch typed := v.(type) {
+	case map[string]any:
+		for k, item := range typed {
+			if _, ok := item.(string); ok && k == "description" {
+				delete(typed, k)
+				continue
+			}
+			typed[k] = stripDescriptions(item)
+		}
+	case []any:
+		for i, item := range typed {
+			typed[i] = stripDescriptions(item)
+		}
+	}
+	return v
+}
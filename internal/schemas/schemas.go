@@ -0,0 +1,56 @@
+package schemas
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultKubeVersion is the Kubernetes minor version whose schemas are used when none is requested.
+const DefaultKubeVersion = "1.27"
+
+//go:generate ./update.sh 1.24.0 1.25.0 1.26.0 1.27.0
+//go:embed kubernetes
+var bundles embed.FS
+
+const bundlesRoot = "kubernetes"
+
+func KubeVersions() []string {
+	entries, _ := bundles.ReadDir(bundlesRoot)
+	versions := []string{}
+	for _, entry := range entries {
+		versions = append(versions, strings.TrimPrefix(entry.Name(), "v"))
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return minorVersion(versions[i]) < minorVersion(versions[j])
+	})
+	return versions
+}
+
+// KubeSchemas returns the compressed OpenAPI v3 schema files embedded for a Kubernetes minor
+// version such as "1.27" or "v1.27".
+func KubeSchemas(version string) (fs.FS, error) {
+	version = strings.TrimPrefix(version, "v")
+	if version == "" {
+		version = DefaultKubeVersion
+	}
+	for _, available := range KubeVersions() {
+		if available == version {
+			return fs.Sub(bundles, path.Join(bundlesRoot, "v"+version))
+		}
+	}
+	return nil, fmt.Errorf("no embedded schemas for Kubernetes version '%s', available versions: %s", version, strings.Join(KubeVersions(), ", "))
+}
+
+func minorVersion(version string) int {
+	parts := strings.SplitN(version, ".", 2)
+	if len(parts) != 2 {
+		return 0
+	}
+	minor, _ := strconv.Atoi(parts[1])
+	return minor
+}
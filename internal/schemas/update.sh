@@ -0,0 +1,12 @@
+#!/usr/bin/env bash
+# Regenerates the embedded schema bundles from the Kubernetes source releases given as arguments, e.g.
+#   ./update.sh 1.24.0 1.25.0 1.26.0 1.27.0
+set -euo pipefail
+
+SCHEMAS_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+
+for release in "$@"; do
+  minor="${release%.*}"
+  module_dir=$(go mod download -json "k8s.io/kubernetes@v${release}" | sed -n 's/^[[:space:]]*"Dir": "\(.*\)",$/\1/p')
+  (cd "${SCHEMAS_DIR}" && go run ./gen -source-dir "${module_dir}/api/openapi-spec/v3" -output-dir "${SCHEMAS_DIR}/kubernetes/v${minor}")
+done
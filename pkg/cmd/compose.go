@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/amannm/configism/pkg/convert"
+	"github.com/spf13/cobra"
+	"io"
+)
+
+func NewComposeCommand() *cobra.Command {
+	schemaOptions := schemaOptions{}
+	cmd := &cobra.Command{
+		Use:          "compose DIR",
+		Short:        "Rebuild full manifests from a folder written by decompose",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			sc, err := schemaOptions.newSchemaClient(nil)
+			if err != nil {
+				return err
+			}
+			resources, err := convert.ComposeFolder(sc, args[0])
+			if err != nil {
+				return err
+			}
+			return writeManifests(cmd.OutOrStdout(), resources)
+		},
+	}
+	schemaOptions.addFlags(cmd)
+	return cmd
+}
+
+func writeManifests(w io.Writer, resources []convert.JSONObject) error {
+	for _, resource := range resources {
+		yamlContent, err := convert.MarshalYAML(resource)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "---\n%s", yamlContent)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
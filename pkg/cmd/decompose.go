@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/amannm/configism/pkg/convert"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+)
+
+const (
+	layoutFolder    = "folder"
+	layoutKustomize = "kustomize"
+	layoutTemplates = "templates"
+)
+
+func NewDecomposeCommand() *cobra.Command {
+	schemaOptions := schemaOptions{}
+	var outputDir string
+	var layout string
+	var verify bool
+	options := generatorOptions{}
+	cmd := &cobra.Command{
+		Use:          "decompose [FILE|DIR|-]...",
+		Short:        "Decompose manifests into a shared base and per-resource patches",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if layout != layoutFolder && layout != layoutKustomize && layout != layoutTemplates {
+				return fmt.Errorf("unsupported output layout '%s'", layout)
+			}
+			err := options.validate()
+			if err != nil {
+				return err
+			}
+			resources, partitions, err := options.decompose(cmd, args, &schemaOptions)
+			if err != nil {
+				return err
+			}
+			if verify {
+				err = verifyPartitions(cmd.ErrOrStderr(), partitions)
+				if err != nil {
+					return err
+				}
+			}
+			err = os.MkdirAll(outputDir, 0755)
+			if err != nil {
+				return err
+			}
+			switch layout {
+			case layoutFolder:
+				for _, partition := range partitions {
+					err = partition.DumpToFolder(outputDir)
+					if err != nil {
+						return err
+					}
+				}
+			case layoutKustomize:
+				err = convert.DumpToKustomization(partitions, outputDir)
+				if err != nil {
+					return err
+				}
+			case layoutTemplates:
+				err = convert.DumpToTemplateLayout(partitions, outputDir)
+				if err != nil {
+					return err
+				}
+			}
+			for _, partition := range partitions {
+				_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s\n", partition.Summary())
+				if err != nil {
+					return err
+				}
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "wrote %d partitions from %d resources to %s\n", len(partitions), len(resources), outputDir)
+			return err
+		},
+	}
+	schemaOptions.addFlags(cmd)
+	options.addFlags(cmd)
+	cmd.Flags().StringVarP(&outputDir, "output-dir", "o", "out", "folder to write partitions into")
+	cmd.Flags().StringVar(&layout, "layout", layoutFolder, "output layout, one of: folder, kustomize, templates")
+	cmd.Flags().BoolVar(&verify, "verify", false, "check that every patch reapplied onto its base reproduces the original resource")
+	return cmd
+}
+
+func verifyPartitions(w io.Writer, partitions []convert.PatchPartition) error {
+	failures := 0
+	for _, partition := range partitions {
+		mismatches, err := partition.Verify()
+		if err != nil {
+			return err
+		}
+		for _, mismatch := range mismatches {
+			failures++
+			_, err = fmt.Fprintf(w, "%s: %s '%s' does not reproduce its original:\n", mismatch.Position, mismatch.GVK.Kind, mismatch.Name)
+			if err != nil {
+				return err
+			}
+			for _, difference := range mismatch.Differences {
+				_, err = fmt.Fprintf(w, "  %s: expected %s, got %s\n", difference.Path, formatDifferenceValue(difference.Expected, difference.ExpectedAbsent), formatDifferenceValue(difference.Actual, difference.ActualAbsent))
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if failures > 0 {
+		return fmt.Errorf("verification failed for %d resources", failures)
+	}
+	return nil
+}
+
+func formatDifferenceValue(v convert.JSONValue, absent bool) string {
+	if absent {
+		return "nothing"
+	}
+	content, _ := json.Marshal(v)
+	return string(content)
+}
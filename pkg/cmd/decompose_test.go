@@ -0,0 +1,301 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/amannm/configism/pkg/convert"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testSchema = `{
+  "openapi": "3.0.0",
+  "info": {"title": "Kubernetes", "version": "unversioned"},
+  "paths": {},
+  "components": {
+    "schemas": {
+      "io.k8s.api.core.v1.ConfigMap": {
+        "type": "object",
+        "properties": {
+          "apiVersion": {"type": "string"},
+          "kind": {"type": "string"},
+          "metadata": {"allOf": [{"$ref": "#/components/schemas/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"}], "default": {}},
+          "data": {"type": "object", "additionalProperties": {"type": "string", "default": ""}}
+        },
+        "x-kubernetes-group-version-kind": [{"group": "", "kind": "ConfigMap", "version": "v1"}]
+      },
+      "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta": {
+        "type": "object",
+        "properties": {
+          "name": {"type": "string"},
+          "namespace": {"type": "string"},
+          "labels": {"type": "object", "additionalProperties": {"type": "string", "default": ""}}
+        }
+      }
+    }
+  }
+}`
+
+const testManifests = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+  labels:
+    app: example
+data:
+  shared: value
+  only: first
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+  labels:
+    app: example
+data:
+  shared: value
+`
+
+func writeTestSchemaDir(t *testing.T) string {
+	schemaDir := t.TempDir()
+	err := os.WriteFile(path.Join(schemaDir, "api__v1_openapi.json"), []byte(testSchema), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schemaDir
+}
+
+func Test_ExecuteDecomposeCommand(t *testing.T) {
+	schemaDir := writeTestSchemaDir(t)
+	outputDir := path.Join(t.TempDir(), "out")
+	cmd := NewRootCommand()
+	b := bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SetIn(strings.NewReader(testManifests))
+	cmd.SetArgs([]string{"decompose", "--schema-dir", schemaDir, "-o", outputDir})
+	err := cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := os.ReadFile(path.Join(outputDir, "_v1_ConfigMap", "base.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(base), "shared: value") || strings.Contains(string(base), "only: first") {
+		t.Fatalf("unexpected base content:\n%s", base)
+	}
+	patch, err := os.ReadFile(path.Join(outputDir, "_v1_ConfigMap", "first.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(patch), "only: first") {
+		t.Fatalf("unexpected patch content:\n%s", patch)
+	}
+}
+
+func Test_ExecuteDecomposeCommandCleanLiveObjects(t *testing.T) {
+	schemaDir := writeTestSchemaDir(t)
+	outputDir := t.TempDir()
+	live := strings.Replace(testManifests, "  name: first\n", "  name: first\n  uid: 1234\n  resourceVersion: \"5\"\n", 1)
+	live = strings.Replace(live, "    app: example\n", "    app: example\n    revision: \"3\"\n", 1)
+	cmd := NewRootCommand()
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SetIn(strings.NewReader(live + "status:\n  phase: Active\n"))
+	cmd.SetArgs([]string{"decompose", "--schema-dir", schemaDir, "-o", outputDir, "--clean-live-objects", "--clean-field", ".metadata.labels.revision"})
+	err := cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch, err := os.ReadFile(path.Join(outputDir, "_v1_ConfigMap", "first.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(patch), "uid") || strings.Contains(string(patch), "resourceVersion") || strings.Contains(string(patch), "revision") {
+		t.Fatalf("unexpected patch content:\n%s", patch)
+	}
+	patch, err = os.ReadFile(path.Join(outputDir, "_v1_ConfigMap", "second.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(patch), "status") {
+		t.Fatalf("unexpected patch content:\n%s", patch)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SetIn(strings.NewReader(testManifests))
+	cmd.SetArgs([]string{"decompose", "--schema-dir", schemaDir, "-o", outputDir, "--clean-field", ".status"})
+	err = cmd.Execute()
+	if err == nil || err.Error() != "--clean-field requires --clean-live-objects" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func Test_ExecuteDecomposeCommandFieldRules(t *testing.T) {
+	schemaDir := writeTestSchemaDir(t)
+	outputDir := t.TempDir()
+	cmd := NewRootCommand()
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SetIn(strings.NewReader(testManifests))
+	cmd.SetArgs([]string{"decompose", "--schema-dir", schemaDir, "-o", outputDir, "--field-rule", "pin-to-patch:v1/ConfigMap:.data.shared", "--field-rule", "ignore:.metadata.labels"})
+	err := cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, err := os.ReadFile(path.Join(outputDir, "_v1_ConfigMap", "base.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(base), "shared") || strings.Contains(string(base), "app: example") {
+		t.Fatalf("unexpected base content:\n%s", base)
+	}
+	patch, err := os.ReadFile(path.Join(outputDir, "_v1_ConfigMap", "second.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(patch), "shared: value") {
+		t.Fatalf("unexpected patch content:\n%s", patch)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SetIn(strings.NewReader(testManifests))
+	cmd.SetArgs([]string{"decompose", "--schema-dir", schemaDir, "-o", outputDir, "--field-rule", "pin-to-base:.data.only"})
+	err = cmd.Execute()
+	if err == nil || !strings.Contains(err.Error(), "ConfigMap 'second' at .data.only: field pinned to the base by '.data.only' is not common to every resource") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SetIn(strings.NewReader(testManifests))
+	cmd.SetArgs([]string{"decompose", "--schema-dir", schemaDir, "-o", outputDir, "--field-rule", "pin-to-base:.data.shared", "--field-rule", "pin-to-patch:ConfigMap:.data.shared"})
+	err = cmd.Execute()
+	if err == nil || err.Error() != "field rule 'pin-to-base:.data.shared' conflicts with field rule 'pin-to-patch:*/*/ConfigMap:.data.shared'" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func Test_ExecuteDecomposeCommandErrors(t *testing.T) {
+	schemaDir := writeTestSchemaDir(t)
+	tests := map[string]struct {
+		input     string
+		schemaDir string
+		expected  string
+	}{
+		"missing schema directory": {
+			input:     testManifests,
+			schemaDir: path.Join(schemaDir, "missing"),
+			expected:  fmt.Sprintf("unable to load schemas from '%s'", path.Join(schemaDir, "missing")),
+		},
+		"missing schema": {
+			input:    "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\n",
+			expected: "resource schema not found for GVK: example.com/v1, Kind=Widget",
+		},
+		"missing name": {
+			input:    "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  labels:\n    app: example\n",
+			expected: "required attribute 'name' not found in resource metadata",
+		},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cmd := NewRootCommand()
+			cmd.SetOut(bytes.NewBufferString(""))
+			cmd.SetErr(bytes.NewBufferString(""))
+			cmd.SetIn(strings.NewReader(test.input))
+			testSchemaDir := schemaDir
+			if test.schemaDir != "" {
+				testSchemaDir = test.schemaDir
+			}
+			cmd.SetArgs([]string{"decompose", "--schema-dir", testSchemaDir, "-o", t.TempDir()})
+			err := cmd.Execute()
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Fatalf("expected error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func Test_ExecuteDecomposeCommandAllErrors(t *testing.T) {
+	schemaDir := writeTestSchemaDir(t)
+	cmd := NewRootCommand()
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SetIn(strings.NewReader("- a\n---\napiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: c\n"))
+	cmd.SetArgs([]string{"decompose", "--schema-dir", schemaDir, "-o", t.TempDir(), "--all-errors"})
+	err := cmd.Execute()
+	expected := `Error: 2 errors:
+  <stdin>:1 (document 1): encountered unexpected non-object type
+  <stdin>:3 (document 2) Widget 'w': resource schema not found for GVK: example.com/v1, Kind=Widget`
+	if err == nil || describeError(err) != expected {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func Test_ExecuteDecomposeCommandKustomizeLayout(t *testing.T) {
+	schemaDir := writeTestSchemaDir(t)
+	outputDir := t.TempDir()
+	cmd := NewRootCommand()
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SetIn(strings.NewReader(testManifests))
+	cmd.SetArgs([]string{"decompose", "--schema-dir", schemaDir, "-o", outputDir, "--layout", "kustomize"})
+	err := cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedFiles := []string{
+		"base/kustomization.yaml",
+		"base/_v1_ConfigMap/kustomization.yaml",
+		"base/_v1_ConfigMap/base.yaml",
+		"overlays/_v1_ConfigMap/first/kustomization.yaml",
+		"overlays/_v1_ConfigMap/first/patch.yaml",
+		"overlays/_v1_ConfigMap/second/kustomization.yaml",
+	}
+	for _, expectedFile := range expectedFiles {
+		_, err := os.Stat(path.Join(outputDir, expectedFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	kustomization, err := os.ReadFile(path.Join(outputDir, "overlays/_v1_ConfigMap/first/kustomization.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(kustomization), "- ../../../base/_v1_ConfigMap") || !strings.Contains(string(kustomization), "name: base") {
+		t.Fatalf("unexpected overlay kustomization:\n%s", kustomization)
+	}
+}
+
+func Test_ExecuteComposeCommand(t *testing.T) {
+	schemaDir := writeTestSchemaDir(t)
+	outputDir := path.Join(t.TempDir(), "out")
+	cmd := NewRootCommand()
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SetIn(strings.NewReader(testManifests))
+	cmd.SetArgs([]string{"decompose", "--schema-dir", schemaDir, "-o", outputDir})
+	err := cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd = NewRootCommand()
+	b := bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"compose", "--schema-dir", schemaDir, outputDir})
+	err = cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	composed, err := convert.ParseYAMLFileIntoJSONObjects(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := convert.ParseYAMLFileIntoJSONObjects([]byte(testManifests))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(composed, expected) {
+		t.Fatalf("unexpected composed manifests:\n%s", b.String())
+	}
+}
@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/amannm/configism/pkg/convert"
+	"github.com/spf13/cobra"
+	"io"
+)
+
+const (
+	diffOutputText = "text"
+	diffOutputJSON = "json"
+)
+
+var diffChangeMarkers = map[convert.ChangeType]string{
+	convert.AddedChange:   "+",
+	convert.RemovedChange: "-",
+	convert.ChangedChange: "~",
+}
+
+func NewDiffCommand() *cobra.Command {
+	schemaOptions := schemaOptions{}
+	var output string
+	cmd := &cobra.Command{
+		Use:          "diff OLD NEW",
+		Short:        "Show the semantic differences between two sets of manifests, resource by resource",
+		Args:         cobra.ExactArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != diffOutputText && output != diffOutputJSON {
+				return fmt.Errorf("unsupported output format '%s'", output)
+			}
+			if args[0] == "-" && args[1] == "-" {
+				return errors.New("only one of OLD and NEW can be read from standard input")
+			}
+			oldDocuments, err := readManifests(cmd.InOrStdin(), args[:1], nil)
+			if err != nil {
+				return err
+			}
+			newDocuments, err := readManifests(cmd.InOrStdin(), args[1:], nil)
+			if err != nil {
+				return err
+			}
+			sc, err := schemaOptions.newSchemaClient(append(append([]convert.ManifestDocument{}, oldDocuments...), newDocuments...))
+			if err != nil {
+				return err
+			}
+			diffs, err := convert.DiffManifests(sc, oldDocuments, newDocuments)
+			if err != nil {
+				return err
+			}
+			if output == diffOutputJSON {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(diffs)
+			}
+			return writeDiffText(cmd.OutOrStdout(), diffs)
+		},
+	}
+	schemaOptions.addFlags(cmd)
+	cmd.Flags().StringVar(&output, "output", diffOutputText, "output format, one of: text, json")
+	return cmd
+}
+
+// writeDiffText writes a header line per resource followed by a line per field, marked '+' when added, '-' when
+// removed and '~' when changed.
+func writeDiffText(w io.Writer, diffs []convert.ResourceDiff) error {
+	for _, diff := range diffs {
+		name := fmt.Sprintf("%s/%s", diff.Version, diff.Kind)
+		if diff.Group != "" {
+			name = fmt.Sprintf("%s/%s/%s", diff.Group, diff.Version, diff.Kind)
+		}
+		_, err := fmt.Fprintf(w, "%s %s '%s'\n", diffChangeMarkers[diff.Change], name, diff.Identity().QualifiedName())
+		if err != nil {
+			return err
+		}
+		for _, field := range diff.Fields {
+			var line string
+			switch field.Change {
+			case convert.AddedChange:
+				line = fmt.Sprintf("%s: %s", field.Path, formatDiffValue(field.New))
+			case convert.RemovedChange:
+				line = fmt.Sprintf("%s: %s", field.Path, formatDiffValue(field.Old))
+			default:
+				line = fmt.Sprintf("%s: %s -> %s", field.Path, formatDiffValue(field.Old), formatDiffValue(field.New))
+			}
+			_, err = fmt.Fprintf(w, "    %s %s\n", diffChangeMarkers[field.Change], line)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func formatDiffValue(v convert.JSONValue) string {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(content)
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/amannm/configism/pkg/convert"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func Test_ExecuteDiffCommand(t *testing.T) {
+	schemaDir := writeTestSchemaDir(t)
+	inputDir := t.TempDir()
+	newManifests := strings.Replace(testManifests, "only: first", "only: changed\n  extra: added", 1)
+	newManifests = strings.Replace(newManifests, "name: second", "name: third", 1)
+	err := os.WriteFile(path.Join(inputDir, "new.yaml"), []byte(newManifests), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := NewRootCommand()
+	b := bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SetIn(strings.NewReader(testManifests))
+	cmd.SetArgs([]string{"diff", "--schema-dir", schemaDir, "-", path.Join(inputDir, "new.yaml")})
+	err = cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `~ v1/ConfigMap 'first'
+    + .data.extra: "added"
+    ~ .data.only: "first" -> "changed"
+- v1/ConfigMap 'second'
++ v1/ConfigMap 'third'
+`
+	if b.String() != expected {
+		t.Fatalf("unexpected diff:\n%s", b.String())
+	}
+
+	cmd = NewRootCommand()
+	b = bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SetIn(strings.NewReader(testManifests))
+	cmd.SetArgs([]string{"diff", "--schema-dir", schemaDir, "--output", "json", "-", path.Join(inputDir, "new.yaml")})
+	err = cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diffs []convert.ResourceDiff
+	err = json.Unmarshal(b.Bytes(), &diffs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 3 || len(diffs[0].Fields) != 2 || diffs[0].Patch == nil || diffs[2].Change != convert.AddedChange {
+		t.Fatalf("unexpected diff report:\n%s", b.String())
+	}
+	if !strings.Contains(b.String(), `"old": null`) {
+		t.Fatalf("expected the old value of an added field to be encoded:\n%s", b.String())
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SetIn(strings.NewReader(testManifests))
+	cmd.SetArgs([]string{"diff", "--schema-dir", schemaDir, "-", "-"})
+	err = cmd.Execute()
+	if err == nil || err.Error() != "only one of OLD and NEW can be read from standard input" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/amannm/configism/pkg/convert"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+func NewEnvironmentsCommand() *cobra.Command {
+	schemaOptions := schemaOptions{}
+	options := generatorOptions{}
+	var outputDir string
+	cmd := &cobra.Command{
+		Use:          "environments NAME=FILE|DIR|-...",
+		Short:        "Decompose the same resources rendered for several environments into a base and an overlay per environment",
+		Args:         cobra.MinimumNArgs(2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			err := options.validateBaseThreshold()
+			if err != nil {
+				return err
+			}
+			err = options.validatePatchOptions()
+			if err != nil {
+				return err
+			}
+			var errs *convert.ErrorList
+			if options.ReportAllErrors {
+				errs = &convert.ErrorList{}
+			}
+			stdinName := ""
+			for _, arg := range args {
+				name, input, ok := strings.Cut(arg, "=")
+				if !ok {
+					return fmt.Errorf("expected an environment as NAME=FILE|DIR|-, got '%s'", arg)
+				}
+				if input == "-" && stdinName != "" {
+					return fmt.Errorf("only one environment can be read from standard input, got '%s' and '%s'", stdinName, name)
+				}
+				if input == "-" {
+					stdinName = name
+				}
+			}
+			environments := []convert.EnvironmentManifests{}
+			allDocuments := []convert.ManifestDocument{}
+			for _, arg := range args {
+				name, input, _ := strings.Cut(arg, "=")
+				documents, err := readManifests(cmd.InOrStdin(), []string{input}, errs)
+				if err != nil {
+					return err
+				}
+				environments = append(environments, convert.EnvironmentManifests{Name: name, Documents: documents})
+				allDocuments = append(allDocuments, documents...)
+			}
+			sc, err := schemaOptions.newSchemaClient(allDocuments)
+			if err != nil {
+				return err
+			}
+			decomposition, err := convert.NewPatchGeneratorFromSchemaClient(sc, options.PatchGeneratorOptions).ExecuteEnvironments(cmd.Context(), environments)
+			if errs != nil && len(*errs) > 0 {
+				return appendErrors(*errs, err)
+			}
+			if err != nil {
+				return err
+			}
+			err = os.MkdirAll(outputDir, 0755)
+			if err != nil {
+				return err
+			}
+			err = decomposition.DumpToKustomization(outputDir)
+			if err != nil {
+				return err
+			}
+			for _, resource := range decomposition.PartialResources() {
+				_, err = fmt.Fprintf(cmd.OutOrStdout(), "%s '%s' is missing from: %s\n", resource.GVK().Kind, resource.Identity().QualifiedName(), strings.Join(resource.MissingEnvironments(), ", "))
+				if err != nil {
+					return err
+				}
+			}
+			_, err = fmt.Fprintf(cmd.OutOrStdout(), "wrote %d resources for %d environments to %s\n", len(decomposition.Resources()), len(environments), outputDir)
+			return err
+		},
+	}
+	schemaOptions.addFlags(cmd)
+	options.addPatchFlags(cmd)
+	cmd.Flags().Float64Var(&options.BaseThreshold, "base-threshold", 100, "percentage of environments that must agree on a field or list item for it to be part of the base")
+	cmd.Flags().StringVarP(&outputDir, "output-dir", "o", "out", "folder to write the base and overlays into")
+	return cmd
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func Test_ExecuteEnvironmentsCommand(t *testing.T) {
+	schemaDir := writeTestSchemaDir(t)
+	inputDir := t.TempDir()
+	manifests := map[string]string{
+		"dev.yaml":  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata:\n  level: debug\n  shared: x\n",
+		"prod.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\ndata:\n  level: info\n  shared: x\n---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: extra\n",
+	}
+	for name, content := range manifests {
+		err := os.WriteFile(path.Join(inputDir, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	outputDir := t.TempDir()
+	cmd := NewRootCommand()
+	b := bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SetArgs([]string{"environments", "--schema-dir", schemaDir, "--no-schema-cache", "-o", outputDir, "dev=" + path.Join(inputDir, "dev.yaml"), "prod=" + path.Join(inputDir, "prod.yaml")})
+	err := cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "ConfigMap 'extra' is missing from: dev") {
+		t.Fatalf("expected partial resources to be reported, got:\n%s", b.String())
+	}
+	base, err := os.ReadFile(path.Join(outputDir, "base", "_v1_ConfigMap_app.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(base), "shared: x") || strings.Contains(string(base), "level") {
+		t.Fatalf("unexpected base:\n%s", base)
+	}
+	patch, err := os.ReadFile(path.Join(outputDir, "overlays", "prod", "_v1_ConfigMap_app.patch.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(patch), "level: info") {
+		t.Fatalf("unexpected patch:\n%s", patch)
+	}
+	_, err = os.Stat(path.Join(outputDir, "overlays", "prod", "_v1_ConfigMap_extra.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd = NewRootCommand()
+	cmd.SetOut(bytes.NewBufferString(""))
+	cmd.SetIn(strings.NewReader(manifests["dev.yaml"]))
+	cmd.SetArgs([]string{"environments", "--schema-dir", schemaDir, "--no-schema-cache", "-o", t.TempDir(), "dev=-", "prod=-"})
+	err = cmd.Execute()
+	if err == nil || err.Error() != "only one environment can be read from standard input, got 'dev' and 'prod'" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github.com/amannm/configism/pkg/convert"
+	"github.com/spf13/cobra"
+)
+
+type generatorOptions struct {
+	convert.PatchGeneratorOptions
+	liveObjectFields []string
+	fieldRules       []string
+}
+
+func (o *generatorOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar((*string)(&o.PartitionOrder), "partition-order", string(convert.GVKPartitionOrder), "order of the emitted partitions, one of: gvk, appearance")
+	cmd.Flags().BoolVar(&o.PartitionByNamespace, "partition-by-namespace", false, "partition resources by namespace in addition to group, version and kind")
+	cmd.Flags().Float64Var(&o.LayerSimilarity, "layer-similarity", 0, "cluster similar resources of a kind into layers while their similarity, between 0 and 1, is at least this value; 0 disables layering")
+	cmd.Flags().Float64Var(&o.BaseThreshold, "base-threshold", 100, "percentage of resources of a kind that must agree on a field or list item for it to be part of the base")
+	o.addPatchFlags(cmd)
+}
+
+// addPatchFlags adds the flags that apply to every kind of decomposition.
+func (o *generatorOptions) addPatchFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar((*string)(&o.PatchFormat), "patch-format", string(convert.MergePatchFormat), "format of the emitted patches, one of: merge, json6902")
+	cmd.Flags().BoolVar(&o.FallbackToMergePatch, "fallback-merge-patch", false, "decompose kinds without a known schema using JSON merge patch semantics instead of failing")
+	cmd.Flags().IntVar(&o.Workers, "workers", 0, "number of partitions and patches computed concurrently; 0 uses one per CPU")
+	cmd.Flags().BoolVar(&o.ReportAllErrors, "all-errors", false, "report every invalid document and resource instead of stopping at the first")
+	cmd.Flags().BoolVar(&o.CleanLiveObjects, "clean-live-objects", false, "remove status, server-populated metadata and the last-applied-configuration annotation before decomposing")
+	cmd.Flags().StringVar((*string)(&o.SchemaDefaults), "schema-defaults", string(convert.KeepSchemaDefaults), "how to treat fields set to their default, from the schema or, unless --schema-dir is given, applied by the API server of --kube-version to builtin kinds, before decomposing, one of: keep, strip, apply")
+	cmd.Flags().StringArrayVar(&o.liveObjectFields, "clean-field", nil, "additional field to remove with --clean-live-objects, as a path such as .metadata.annotations.example\\.com/revision; may be repeated")
+	cmd.Flags().StringArrayVar(&o.fieldRules, "field-rule", nil, "rule as ACTION:[SCOPE:]SELECTOR, such as pin-to-patch:apps/v1/Deployment:.spec.template.spec.containers[*].image, with ACTION one of: pin-to-patch, pin-to-base, ignore; may be repeated")
+}
+
+// validate checks the flags added by addFlags.
+func (o *generatorOptions) validate() error {
+	if o.PartitionOrder != convert.GVKPartitionOrder && o.PartitionOrder != convert.AppearancePartitionOrder {
+		return fmt.Errorf("unsupported partition order '%s'", o.PartitionOrder)
+	}
+	if o.LayerSimilarity < 0 || o.LayerSimilarity > 1 {
+		return fmt.Errorf("layer similarity must be between 0 and 1, got %v", o.LayerSimilarity)
+	}
+	err := o.validateBaseThreshold()
+	if err != nil {
+		return err
+	}
+	return o.validatePatchOptions()
+}
+
+func (o *generatorOptions) validateBaseThreshold() error {
+	if o.BaseThreshold <= 0 || o.BaseThreshold > 100 {
+		return fmt.Errorf("base threshold must be a percentage above 0 and at most 100, got %v", o.BaseThreshold)
+	}
+	return nil
+}
+
+// validatePatchOptions checks the flags added by addPatchFlags.
+func (o *generatorOptions) validatePatchOptions() error {
+	if o.PatchFormat != convert.MergePatchFormat && o.PatchFormat != convert.JSON6902PatchFormat {
+		return fmt.Errorf("unsupported patch format '%s'", o.PatchFormat)
+	}
+	if o.SchemaDefaults != convert.KeepSchemaDefaults && o.SchemaDefaults != convert.StripSchemaDefaults && o.SchemaDefaults != convert.ApplySchemaDefaults {
+		return fmt.Errorf("unsupported schema defaults mode '%s'", o.SchemaDefaults)
+	}
+	if o.Workers < 0 {
+		return fmt.Errorf("workers must not be negative, got %d", o.Workers)
+	}
+	if len(o.liveObjectFields) > 0 && !o.CleanLiveObjects {
+		return errors.New("--clean-field requires --clean-live-objects")
+	}
+	o.LiveObjectFields = nil
+	for _, field := range o.liveObjectFields {
+		path, err := convert.ParseFieldPath(field)
+		if err != nil {
+			return err
+		}
+		o.LiveObjectFields = append(o.LiveObjectFields, path)
+	}
+	o.FieldRules = nil
+	for _, value := range o.fieldRules {
+		rule, err := convert.ParseFieldRule(value)
+		if err != nil {
+			return err
+		}
+		o.FieldRules = append(o.FieldRules, rule)
+	}
+	return convert.ValidateFieldRules(o.FieldRules)
+}
+
+// decompose reads the manifests named by args, loads their schemas and partitions them. With ReportAllErrors,
+// documents that cannot be decoded are reported along with the resources that cannot be decomposed.
+func (o *generatorOptions) decompose(cmd *cobra.Command, args []string, schemaOptions *schemaOptions) ([]convert.ManifestDocument, []convert.PatchPartition, error) {
+	var errs *convert.ErrorList
+	if o.ReportAllErrors {
+		errs = &convert.ErrorList{}
+	}
+	documents, err := readManifests(cmd.InOrStdin(), args, errs)
+	if err != nil {
+		return nil, nil, err
+	}
+	sc, err := schemaOptions.newSchemaClient(documents)
+	if err != nil {
+		return nil, nil, err
+	}
+	partitions, err := convert.NewPatchGeneratorFromSchemaClient(sc, o.PatchGeneratorOptions).ExecuteDocuments(cmd.Context(), documents)
+	if errs != nil && len(*errs) > 0 {
+		return nil, nil, appendErrors(*errs, err)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return documents, partitions, nil
+}
+
+// appendErrors adds the errors of a decomposition, if any, to the errors found while reading its input.
+func appendErrors(errs convert.ErrorList, err error) convert.ErrorList {
+	var decomposeErrs convert.ErrorList
+	if errors.As(err, &decomposeErrs) {
+		return append(errs, decomposeErrs...)
+	}
+	if err != nil {
+		return append(errs, err)
+	}
+	return errs
+}
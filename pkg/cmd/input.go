@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"errors"
+	"github.com/amannm/configism/pkg/convert"
+	"io"
+	"os"
+	"path"
+	"strings"
+)
+
+var manifestFileSuffixes = []string{".yaml", ".yml", ".json"}
+
+// readManifests decodes the documents of every file named by args, reading directories non-recursively
+// and stdin for "-" or when args is empty. When errs is not nil, documents that cannot be decoded are skipped
+// and appended to it instead of ending the read.
+func readManifests(stdin io.Reader, args []string, errs *convert.ErrorList) ([]convert.ManifestDocument, error) {
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	result := []convert.ManifestDocument{}
+	for _, arg := range args {
+		if arg == "-" {
+			documents, err := readManifestStream(stdin, convert.StdinFileName, errs)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, documents...)
+			continue
+		}
+		files, err := manifestFiles(arg)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			documents, err := readManifestFile(file, errs)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, documents...)
+		}
+	}
+	return result, nil
+}
+
+func manifestFiles(arg string) ([]string, error) {
+	info, err := os.Stat(arg)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{arg}, nil
+	}
+	entries, err := os.ReadDir(arg)
+	if err != nil {
+		return nil, err
+	}
+	result := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		for _, suffix := range manifestFileSuffixes {
+			if strings.HasSuffix(entry.Name(), suffix) {
+				result = append(result, path.Join(arg, entry.Name()))
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+func readManifestFile(file string, errs *convert.ErrorList) ([]convert.ManifestDocument, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	return readManifestStream(f, file, errs)
+}
+
+// readManifestStream decodes every document of a stream. When errs is not nil, documents that cannot be decoded
+// are appended to it instead of ending the stream; errors reading the stream itself are always returned.
+func readManifestStream(r io.Reader, file string, errs *convert.ErrorList) ([]convert.ManifestDocument, error) {
+	if errs == nil {
+		return convert.ReadManifestDocuments(r, file)
+	}
+	decoder := convert.NewManifestDecoder(r, file)
+	result := []convert.ManifestDocument{}
+	for {
+		document, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		var invalid *convert.InvalidDocumentError
+		var nonObject *convert.NonObjectDocumentError
+		if errors.As(err, &invalid) || errors.As(err, &nonObject) {
+			*errs = append(*errs, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, document)
+	}
+}
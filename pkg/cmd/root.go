@@ -1,24 +1,51 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"github.com/amannm/configism/pkg/convert"
 	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"strings"
 )
 
 func NewRootCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use: "configism",
+		Use:           "configism",
+		SilenceErrors: true,
 	}
 	cmd.AddCommand(NewVersionCommand())
+	cmd.AddCommand(NewDecomposeCommand())
+	cmd.AddCommand(NewComposeCommand())
+	cmd.AddCommand(NewStatsCommand())
+	cmd.AddCommand(NewEnvironmentsCommand())
+	cmd.AddCommand(NewDiffCommand())
 	return cmd
 }
 
 func Execute() int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
 	rootCmd := NewRootCommand()
-	err := rootCmd.Execute()
+	err := rootCmd.ExecuteContext(ctx)
 	if err != nil {
-		fmt.Println(err)
+		_, _ = fmt.Fprintln(rootCmd.ErrOrStderr(), describeError(err))
 		return 1
 	}
 	return 0
 }
+
+// describeError renders an error for the terminal, listing every error on its own line when a run reported several.
+func describeError(err error) string {
+	var errs convert.ErrorList
+	if errors.As(err, &errs) && len(errs) > 1 {
+		lines := make([]string, 0, len(errs))
+		for _, err := range errs {
+			lines = append(lines, fmt.Sprintf("  %s", err))
+		}
+		return fmt.Sprintf("Error: %d errors:\n%s", len(errs), strings.Join(lines, "\n"))
+	}
+	return fmt.Sprintf("Error: %s", err)
+}
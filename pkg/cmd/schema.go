@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"github.com/amannm/configism/internal/schemas"
+	"github.com/amannm/configism/pkg/convert"
+	"github.com/spf13/cobra"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+type schemaOptions struct {
+	schemaDir      string
+	kubeVersion    string
+	crdDir         string
+	schemaCacheDir string
+	noSchemaCache  bool
+}
+
+func (o *schemaOptions) addFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.schemaDir, "schema-dir", "", "folder containing Kubernetes *_openapi.json schema files, overrides --kube-version")
+	cmd.Flags().StringVar(&o.crdDir, "crd-dir", "", "folder containing CustomResourceDefinition manifests to derive custom resource schemas from")
+	cmd.Flags().StringVar(&o.schemaCacheDir, "schema-cache-dir", "", "folder to cache compiled schemas in, a folder under the user cache directory by default")
+	cmd.Flags().BoolVar(&o.noSchemaCache, "no-schema-cache", false, "compile schemas on every run instead of caching them")
+	cmd.Flags().StringVar(&o.kubeVersion, "kube-version", schemas.DefaultKubeVersion, fmt.Sprintf("Kubernetes version of the builtin schemas, one of: %s", strings.Join(schemas.KubeVersions(), ", ")))
+}
+
+// newSchemaClient loads the selected API schemas and registers every CustomResourceDefinition found
+// in the --crd-dir folder or among the given input resources.
+func (o *schemaOptions) newSchemaClient(documents []convert.ManifestDocument) (*convert.SchemaClient, error) {
+	sc, err := o.loadSchemaClient()
+	if err != nil {
+		return nil, err
+	}
+	if o.crdDir != "" {
+		crds, err := readManifests(nil, []string{o.crdDir}, nil)
+		if err != nil {
+			return nil, err
+		}
+		err = sc.RegisterCustomResourceDefinitionDocuments(crds)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = sc.RegisterCustomResourceDefinitionDocuments(documents)
+	if err != nil {
+		return nil, err
+	}
+	return sc, nil
+}
+
+func (o *schemaOptions) loadSchemaClient() (*convert.SchemaClient, error) {
+	if o.schemaDir != "" {
+		sc, err := o.compileSchemas(os.DirFS(o.schemaDir))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load schemas from '%s': %w", o.schemaDir, err)
+		}
+		return sc, nil
+	}
+	bundle, err := schemas.KubeSchemas(o.kubeVersion)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := o.compileSchemas(bundle)
+	if err != nil {
+		return nil, err
+	}
+	sc.SetKubeVersion(o.kubeVersion)
+	return sc, nil
+}
+
+// compileSchemas loads the schema files of schemaFS through the schema cache, unless caching is disabled or
+// no cache folder is available.
+func (o *schemaOptions) compileSchemas(schemaFS fs.FS) (*convert.SchemaClient, error) {
+	if o.noSchemaCache {
+		return convert.NewSchemaClientFromFS(schemaFS)
+	}
+	cacheDir := o.schemaCacheDir
+	if cacheDir == "" {
+		var err error
+		cacheDir, err = convert.DefaultSchemaCacheDir()
+		if err != nil {
+			return convert.NewSchemaClientFromFS(schemaFS)
+		}
+	}
+	return convert.NewCachedSchemaClientFromFS(schemaFS, cacheDir)
+}
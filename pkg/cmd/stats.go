@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/amannm/configism/pkg/convert"
+	"github.com/spf13/cobra"
+	"io"
+	"text/tabwriter"
+)
+
+const (
+	statsOutputTable = "table"
+	statsOutputJSON  = "json"
+)
+
+type statsReport struct {
+	Partitions []statsEntry `json:"partitions"`
+	Total      statsEntry   `json:"total"`
+}
+
+type statsEntry struct {
+	convert.PartitionStats
+	DecomposedLines  int     `json:"decomposedLines"`
+	DecomposedBytes  int     `json:"decomposedBytes"`
+	CompressionRatio float64 `json:"compressionRatio"`
+}
+
+func newStatsEntry(stats convert.PartitionStats) statsEntry {
+	return statsEntry{
+		PartitionStats:   stats,
+		DecomposedLines:  stats.DecomposedLines(),
+		DecomposedBytes:  stats.DecomposedBytes(),
+		CompressionRatio: stats.CompressionRatio(),
+	}
+}
+
+func NewStatsCommand() *cobra.Command {
+	schemaOptions := schemaOptions{}
+	options := generatorOptions{}
+	var output string
+	cmd := &cobra.Command{
+		Use:          "stats [FILE|DIR|-]...",
+		Short:        "Report how much duplication decomposition removes from manifests",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != statsOutputTable && output != statsOutputJSON {
+				return fmt.Errorf("unsupported output format '%s'", output)
+			}
+			err := options.validate()
+			if err != nil {
+				return err
+			}
+			_, partitions, err := options.decompose(cmd, args, &schemaOptions)
+			if err != nil {
+				return err
+			}
+			report := statsReport{Partitions: []statsEntry{}}
+			total := convert.PartitionStats{}
+			for _, partition := range partitions {
+				stats, err := partition.Stats()
+				if err != nil {
+					return err
+				}
+				report.Partitions = append(report.Partitions, newStatsEntry(stats))
+				total = total.Add(stats)
+			}
+			report.Total = newStatsEntry(total)
+			if output == statsOutputJSON {
+				encoder := json.NewEncoder(cmd.OutOrStdout())
+				encoder.SetIndent("", "  ")
+				return encoder.Encode(report)
+			}
+			return writeStatsTable(cmd.OutOrStdout(), report)
+		},
+	}
+	schemaOptions.addFlags(cmd)
+	options.addFlags(cmd)
+	cmd.Flags().StringVar(&output, "output", statsOutputTable, "output format, one of: table, json")
+	return cmd
+}
+
+func writeStatsTable(w io.Writer, report statsReport) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	_, err := fmt.Fprintln(tw, "PARTITION\tSOURCES\tORIGINAL LINES\tBASE LINES\tLAYER LINES\tPATCH LINES\tORIGINAL BYTES\tDECOMPOSED BYTES\tRATIO")
+	if err != nil {
+		return err
+	}
+	rows := append([]statsEntry{}, report.Partitions...)
+	for i, entry := range append(rows, report.Total) {
+		name := "TOTAL"
+		if i < len(report.Partitions) {
+			name = fmt.Sprintf("%s/%s/%s", entry.Group, entry.Version, entry.Kind)
+			if entry.Group == "" {
+				name = fmt.Sprintf("%s/%s", entry.Version, entry.Kind)
+			}
+			if entry.Namespace != "" {
+				name = fmt.Sprintf("%s (%s)", name, entry.Namespace)
+			}
+		}
+		_, err = fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%.2f\n", name, entry.Sources, entry.OriginalLines, entry.BaseLines, entry.LayerLines, entry.PatchLines, entry.OriginalBytes, entry.DecomposedBytes, entry.CompressionRatio)
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func Test_ExecuteStatsCommand(t *testing.T) {
+	schemaDir := writeTestSchemaDir(t)
+	cmd := NewRootCommand()
+	b := bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SetIn(strings.NewReader(testManifests))
+	cmd.SetArgs([]string{"stats", "--schema-dir", schemaDir, "--output", "json"})
+	err := cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report statsReport
+	err = json.Unmarshal(b.Bytes(), &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Partitions) != 1 || report.Partitions[0].Kind != "ConfigMap" || report.Total.Sources != 2 {
+		t.Fatalf("unexpected stats report:\n%s", b.String())
+	}
+	if report.Total.OriginalLines == 0 || report.Total.DecomposedBytes != report.Total.BaseBytes+report.Total.PatchBytes {
+		t.Fatalf("unexpected stats totals:\n%s", b.String())
+	}
+
+	cmd = NewRootCommand()
+	b = bytes.NewBufferString("")
+	cmd.SetOut(b)
+	cmd.SetIn(strings.NewReader(testManifests))
+	cmd.SetArgs([]string{"stats", "--schema-dir", schemaDir})
+	err = cmd.Execute()
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "v1/ConfigMap ") || !strings.HasPrefix(lines[2], "TOTAL ") {
+		t.Fatalf("unexpected stats table:\n%s", b.String())
+	}
+}
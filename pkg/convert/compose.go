@@ -0,0 +1,180 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8spatch "k8s.io/apimachinery/pkg/util/strategicpatch"
+	"os"
+	"path"
+	"sigs.k8s.io/yaml"
+)
+
+// Compose applies each strategic merge or JSON merge patch onto the base, returning one resource per patch.
+// lookupMeta is usually obtained from SchemaClient.GetPatchMetadata; a nil lookupMeta applies plain JSON merge patches.
+func Compose(base JSONObject, patches []JSONObject, lookupMeta k8spatch.LookupPatchMeta) ([]JSONObject, error) {
+	if lookupMeta == nil {
+		lookupMeta = jsonMergePatchMeta
+	}
+	result := make([]JSONObject, 0, len(patches))
+	for i, patch := range patches {
+		resource, err := applyPatch(base, patch, lookupMeta)
+		if err != nil {
+			return nil, fmt.Errorf("unable to apply patch #%d: %w", i+1, err)
+		}
+		result = append(result, resource)
+	}
+	return result, nil
+}
+
+// ComposeJSONPatches applies each list of RFC 6902 operations onto the base, returning one resource per list.
+func ComposeJSONPatches(base JSONObject, patches [][]JSONPatchOperation) ([]JSONObject, error) {
+	result := make([]JSONObject, 0, len(patches))
+	for i, operations := range patches {
+		resource, err := applyJSONPatch(base, operations)
+		if err != nil {
+			return nil, fmt.Errorf("unable to apply patch #%d: %w", i+1, err)
+		}
+		result = append(result, resource)
+	}
+	return result, nil
+}
+
+// ComposeFolder rebuilds the resources of every partition written by PatchPartition.DumpToFolder into
+// directoryPath, which may also be a single partition folder. Partitions are read in folder name order.
+func ComposeFolder(sc *SchemaClient, directoryPath string) ([]JSONObject, error) {
+	if _, err := os.Stat(path.Join(directoryPath, partitionFileName)); err == nil {
+		return composePartitionFolder(sc, directoryPath)
+	}
+	entries, err := os.ReadDir(directoryPath)
+	if err != nil {
+		return nil, err
+	}
+	result := []JSONObject{}
+	for _, entry := range entries {
+		partitionDir := path.Join(directoryPath, entry.Name())
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(path.Join(partitionDir, partitionFileName)); err != nil {
+			continue
+		}
+		resources, err := composePartitionFolder(sc, partitionDir)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, resources...)
+	}
+	return result, nil
+}
+
+type partitionDescription struct {
+	Group     string             `json:"group"`
+	Version   string             `json:"version"`
+	Kind      string             `json:"kind"`
+	Namespace string             `json:"namespace"`
+	Strategy  PatchStrategy      `json:"strategy"`
+	Format    PatchFormat        `json:"format"`
+	Sources   []string           `json:"sources"`
+	Layers    []layerDescription `json:"layers"`
+}
+
+type layerDescription struct {
+	Name    string   `json:"name"`
+	Parent  string   `json:"parent"`
+	Sources []string `json:"sources"`
+}
+
+func composePartitionFolder(sc *SchemaClient, partitionDir string) ([]JSONObject, error) {
+	var description partitionDescription
+	err := readYAMLFile(path.Join(partitionDir, partitionFileName), &description)
+	if err != nil {
+		return nil, err
+	}
+	if description.Format != MergePatchFormat && description.Format != JSON6902PatchFormat {
+		return nil, fmt.Errorf("unsupported patch format '%s' in '%s'", description.Format, partitionDir)
+	}
+	var base JSONObject
+	err = readYAMLFile(path.Join(partitionDir, "base.yaml"), &base)
+	if err != nil {
+		return nil, err
+	}
+	if base == nil {
+		base = JSONObject{}
+	}
+	lookupMeta := jsonMergePatchMeta
+	if description.Format == MergePatchFormat && description.Strategy != JSONMergePatchStrategy {
+		gvk := schema.GroupVersionKind{Group: description.Group, Version: description.Version, Kind: description.Kind}
+		lookupMeta, err = sc.GetPatchMetadata(gvk)
+		if err != nil {
+			return nil, err
+		}
+	}
+	layerBases := map[string]JSONObject{"": base}
+	sourceLayers := map[string]string{}
+	for _, layer := range description.Layers {
+		parentBase, ok := layerBases[layer.Parent]
+		if !ok {
+			return nil, fmt.Errorf("layer '%s' in '%s' refers to unknown parent layer '%s'", layer.Name, partitionDir, layer.Parent)
+		}
+		layerBases[layer.Name], err = applyPatchFile(parentBase, path.Join(partitionDir, layersFolderName, fmt.Sprintf("%s.yaml", layer.Name)), description.Format, lookupMeta)
+		if err != nil {
+			return nil, err
+		}
+		for _, source := range layer.Sources {
+			sourceLayers[source] = layer.Name
+		}
+	}
+	resources := make([]JSONObject, 0, len(description.Sources))
+	for _, source := range description.Sources {
+		resource, err := applyPatchFile(layerBases[sourceLayers[source]], path.Join(partitionDir, fmt.Sprintf("%s.yaml", source)), description.Format, lookupMeta)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// applyPatchFile applies the patch document stored in filePath onto the base.
+func applyPatchFile(base JSONObject, filePath string, format PatchFormat, lookupMeta k8spatch.LookupPatchMeta) (JSONObject, error) {
+	var result JSONObject
+	if format == JSON6902PatchFormat {
+		var operations []JSONPatchOperation
+		err := readYAMLFile(filePath, &operations)
+		if err != nil {
+			return nil, err
+		}
+		result, err = applyJSONPatch(base, operations)
+		if err != nil {
+			return nil, fmt.Errorf("unable to apply '%s': %w", filePath, err)
+		}
+		return result, nil
+	}
+	var patch JSONObject
+	err := readYAMLFile(filePath, &patch)
+	if err != nil {
+		return nil, err
+	}
+	result, err = applyPatch(base, patch, lookupMeta)
+	if err != nil {
+		return nil, fmt.Errorf("unable to apply '%s': %w", filePath, err)
+	}
+	return result, nil
+}
+
+func readYAMLFile(filePath string, v any) error {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	jsonContent, err := yaml.YAMLToJSON(content)
+	if err != nil {
+		return fmt.Errorf("unable to parse '%s': %w", filePath, err)
+	}
+	err = json.Unmarshal(jsonContent, v)
+	if err != nil {
+		return fmt.Errorf("unable to parse '%s': %w", filePath, err)
+	}
+	return nil
+}
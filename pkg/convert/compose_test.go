@@ -0,0 +1,204 @@
+package convert
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func Test_ComposeFolder(t *testing.T) {
+	objects, err := ParseYAMLFileIntoJSONObjects([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sc.RegisterCustomResourceDefinitions(objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []PatchFormat{MergePatchFormat, JSON6902PatchFormat} {
+		options := PatchGeneratorOptions{PatchFormat: format, FallbackToMergePatch: true}
+		results, err := NewPatchGeneratorFromSchemaClient(sc, options).Execute(context.Background(), objects)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputDir := t.TempDir()
+		expected := []JSONObject{}
+		for _, result := range results {
+			err = result.DumpToFolder(outputDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, source := range result.Sources() {
+				expected = append(expected, source.Original())
+			}
+		}
+		composed, err := ComposeFolder(sc, outputDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(composed) != len(expected) {
+			t.Fatalf("%s: expected %d resources, got %d", format, len(expected), len(composed))
+		}
+		for i := range expected {
+			if !reflect.DeepEqual(composed[i], expected[i]) {
+				t.Fatalf("%s: resource #%d does not match its original", format, i+1)
+			}
+		}
+	}
+}
+
+const layeredInput = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend-a
+  labels:
+    tier: frontend
+spec:
+  replicas: 2
+  selector:
+    matchLabels:
+      app: frontend-a
+  template:
+    metadata:
+      labels:
+        app: frontend-a
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.25
+        ports:
+        - containerPort: 80
+        env:
+        - name: MODE
+          value: frontend
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: frontend-b
+  labels:
+    tier: frontend
+spec:
+  replicas: 3
+  selector:
+    matchLabels:
+      app: frontend-b
+  template:
+    metadata:
+      labels:
+        app: frontend-b
+    spec:
+      containers:
+      - name: nginx
+        image: nginx:1.25
+        ports:
+        - containerPort: 80
+        env:
+        - name: MODE
+          value: frontend
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker-a
+  labels:
+    tier: worker
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: worker-a
+  template:
+    metadata:
+      labels:
+        app: worker-a
+    spec:
+      serviceAccountName: worker
+      containers:
+      - name: worker
+        image: example.com/worker:2.0
+        args:
+        - --queue=default
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker-b
+  labels:
+    tier: worker
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: worker-b
+  template:
+    metadata:
+      labels:
+        app: worker-b
+    spec:
+      serviceAccountName: worker
+      containers:
+      - name: worker
+        image: example.com/worker:2.0
+        args:
+        - --queue=priority
+`
+
+func Test_Layers(t *testing.T) {
+	objects, err := ParseYAMLFileIntoJSONObjects([]byte(layeredInput))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, format := range []PatchFormat{MergePatchFormat, JSON6902PatchFormat} {
+		options := PatchGeneratorOptions{PatchFormat: format, LayerSimilarity: 0.5}
+		results, err := NewPatchGeneratorFromSchemaClient(sc, options).Execute(context.Background(), objects)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(results) != 1 {
+			t.Fatalf("%s: expected a single partition, got %d", format, len(results))
+		}
+		result := results[0]
+		layers := []string{}
+		for _, layer := range result.Layers() {
+			layers = append(layers, layer.Name()+"<"+layer.Parent())
+		}
+		if !reflect.DeepEqual(layers, []string{"layer-1<", "layer-2<"}) {
+			t.Fatalf("%s: unexpected layers: %v", format, layers)
+		}
+		sourceLayers := []string{}
+		for _, source := range result.Sources() {
+			sourceLayers = append(sourceLayers, source.Layer())
+		}
+		if !reflect.DeepEqual(sourceLayers, []string{"layer-1", "layer-1", "layer-2", "layer-2"}) {
+			t.Fatalf("%s: unexpected source layers: %v", format, sourceLayers)
+		}
+		mismatches, err := result.Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mismatches) > 0 {
+			t.Fatalf("%s: unexpected mismatches: %v", format, mismatches)
+		}
+		outputDir := t.TempDir()
+		err = result.DumpToFolder(outputDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		composed, err := ComposeFolder(sc, outputDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(composed, objects) {
+			t.Fatalf("%s: composed resources do not match their originals", format)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kube-openapi/pkg/util/proto"
+)
+
+const customResourceDefinitionGroup = "apiextensions.k8s.io"
+
+func IsCustomResourceDefinition(resource JSONObject) bool {
+	gvk, err := ComputeGVK(resource)
+	if err != nil {
+		return false
+	}
+	return gvk.Group == customResourceDefinitionGroup && gvk.Kind == "CustomResourceDefinition"
+}
+
+// RegisterCustomResourceDefinitions registers the schema of every served version of every
+// CustomResourceDefinition among the given resources, ignoring all other resources.
+func (sc *SchemaClient) RegisterCustomResourceDefinitions(resources []JSONObject) error {
+	documents := make([]ManifestDocument, 0, len(resources))
+	for _, resource := range resources {
+		documents = append(documents, ManifestDocument{Object: resource})
+	}
+	return sc.RegisterCustomResourceDefinitionDocuments(documents)
+}
+
+// RegisterCustomResourceDefinitionDocuments registers CustomResourceDefinitions like RegisterCustomResourceDefinitions,
+// reporting errors at the position each definition was read from.
+func (sc *SchemaClient) RegisterCustomResourceDefinitionDocuments(documents []ManifestDocument) error {
+	for i, document := range documents {
+		if !IsCustomResourceDefinition(document.Object) {
+			continue
+		}
+		err := sc.RegisterCustomResourceDefinition(document.Object)
+		if err != nil {
+			name, _ := GetResourceName(document.Object)
+			return fmt.Errorf("%s: unable to register CustomResourceDefinition '%s': %w", describeLocation(i, document.Position), name, err)
+		}
+	}
+	return nil
+}
+
+func (sc *SchemaClient) RegisterCustomResourceDefinition(crd JSONObject) error {
+	spec, ok := crd["spec"].(JSONObject)
+	if !ok {
+		return fmt.Errorf("required property 'spec' not found in resource declaration")
+	}
+	group, ok := spec["group"].(string)
+	if !ok {
+		return fmt.Errorf("required property 'spec.group' must be a string")
+	}
+	names, _ := spec["names"].(JSONObject)
+	kind, ok := names["kind"].(string)
+	if !ok {
+		return fmt.Errorf("required property 'spec.names.kind' must be a string")
+	}
+	// apiextensions.k8s.io/v1beta1 declares a single schema shared by every version
+	sharedSchema := lookupOpenAPIV3Schema(spec["validation"])
+	versions, _ := spec["versions"].(JSONArray)
+	if version, ok := spec["version"].(string); ok && len(versions) == 0 {
+		versions = JSONArray{JSONObject{"name": version}}
+	}
+	for _, version := range versions {
+		typedVersion, ok := version.(JSONObject)
+		if !ok {
+			continue
+		}
+		versionName, ok := typedVersion["name"].(string)
+		if !ok {
+			return fmt.Errorf("required property 'spec.versions[].name' must be a string")
+		}
+		if served, ok := typedVersion["served"].(bool); ok && !served {
+			continue
+		}
+		versionSchema := lookupOpenAPIV3Schema(typedVersion["schema"])
+		if versionSchema == nil {
+			versionSchema = sharedSchema
+		}
+		if versionSchema == nil {
+			continue
+		}
+		gvk := schema.GroupVersionKind{Group: group, Version: versionName, Kind: kind}
+		modelSchema, err := parseCustomResourceSchema(gvk, versionSchema)
+		if err != nil {
+			return fmt.Errorf("invalid schema for version '%s': %w", versionName, err)
+		}
+		sc.gvkLookup[gvk] = modelSchema
+		sc.customResources[gvk] = true
+	}
+	return nil
+}
+
+func lookupOpenAPIV3Schema(validation JSONValue) JSONObject {
+	if typedValidation, ok := validation.(JSONObject); ok {
+		if openAPIV3Schema, ok := typedValidation["openAPIV3Schema"].(JSONObject); ok {
+			return openAPIV3Schema
+		}
+	}
+	return nil
+}
+
+func parseCustomResourceSchema(gvk schema.GroupVersionKind, openAPIV3Schema JSONObject) (*proto.Schema, error) {
+	modelName := fmt.Sprintf("%s.%s.%s", gvk.Group, gvk.Version, gvk.Kind)
+	modelSchema := cloneJSON(openAPIV3Schema)
+	modelSchema[groupVersionKindExtensionKey] = JSONArray{JSONObject{
+		"group":   gvk.Group,
+		"version": gvk.Version,
+		"kind":    gvk.Kind,
+	}}
+	doc := JSONObject{
+		"openapi": "3.0.0",
+		"info": JSONObject{
+			"title":   modelName,
+			"version": gvk.Version,
+		},
+		"paths": JSONObject{},
+		"components": JSONObject{
+			"schemas": JSONObject{
+				modelName: modelSchema,
+			},
+		},
+	}
+	docBytes, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	models, err := parseSchemaModels(docBytes)
+	if err != nil {
+		return nil, err
+	}
+	model := models.LookupModel(modelName)
+	if model == nil {
+		return nil, fmt.Errorf("unsupported schema for %s", gvk.String())
+	}
+	return &model, nil
+}
@@ -0,0 +1,159 @@
+package convert
+
+import (
+	"context"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"os"
+	"testing"
+)
+
+const widgetCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+    plural: widgets
+  scope: Namespaced
+  versions:
+    - name: v1
+      served: true
+      storage: true
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            apiVersion:
+              type: string
+            kind:
+              type: string
+            metadata:
+              type: object
+            spec:
+              type: object
+              properties:
+                parts:
+                  type: array
+                  x-kubernetes-list-type: map
+                  x-kubernetes-list-map-keys:
+                    - name
+                  items:
+                    type: object
+                    properties:
+                      name:
+                        type: string
+                      size:
+                        type: integer
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: small
+  labels:
+    app: widgets
+spec:
+  parts:
+    - name: gear
+      size: 1
+    - name: spring
+      size: 2
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: large
+  labels:
+    app: widgets
+spec:
+  parts:
+    - name: gear
+      size: 10
+    - name: spring
+      size: 2
+`
+
+func Test_CustomResourcePatchMetadata(t *testing.T) {
+	objects, err := ParseYAMLFileIntoJSONObjects([]byte(widgetCRD))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sc.RegisterCustomResourceDefinitions(objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pg := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{})
+	results, err := pg.Execute(context.Background(), objects[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("expected a single partition, got %d", len(results))
+	}
+	base := results[0].base
+	labels := base["metadata"].(JSONObject)["labels"].(JSONObject)
+	if labels["app"] != "widgets" {
+		t.Fatalf("expected shared labels in base, got %v", base)
+	}
+	patchedParts := results[0].sources[1].patch["spec"].(JSONObject)["parts"].(JSONArray)
+	if len(patchedParts) != 1 {
+		t.Fatalf("expected list items to be patched by name, got %v", patchedParts)
+	}
+	mismatches, err := results[0].Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) > 0 {
+		t.Fatalf("unexpected verification mismatches: %v", mismatches)
+	}
+}
+
+func Test_RegisterCertManagerCRDs(t *testing.T) {
+	content, err := os.ReadFile("./testing/cert-manager.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects, err := ParseYAMLFileIntoJSONObjects(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sc.RegisterCustomResourceDefinitions(objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificate := JSONObject{"apiVersion": "cert-manager.io/v1", "kind": "Certificate"}
+	_, err = sc.GetSchemaByGVK(certificate)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_ListMapPatchMetadata(t *testing.T) {
+	listMap := func(keys ...string) proto.Schema {
+		mapKeys := JSONArray{}
+		for _, key := range keys {
+			mapKeys = append(mapKeys, key)
+		}
+		return &proto.Array{BaseSchema: proto.BaseSchema{Extensions: map[string]interface{}{
+			listTypeExtensionKey:    "map",
+			listMapKeysExtensionKey: mapKeys,
+		}}}
+	}
+	patchMeta := parsePatchMeta(listMap("name"))
+	if strategies := patchMeta.GetPatchStrategies(); len(strategies) != 1 || strategies[0] != "merge" || patchMeta.GetPatchMergeKey() != "name" {
+		t.Fatalf("expected a list map with a single key to be merged by it, got %v", patchMeta)
+	}
+	patchMeta = parsePatchMeta(listMap("containerPort", "protocol"))
+	if len(patchMeta.GetPatchStrategies()) != 0 || patchMeta.GetPatchMergeKey() != "" {
+		t.Fatalf("expected a list map with several keys to be atomic, got %v", patchMeta)
+	}
+}
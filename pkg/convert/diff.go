@@ -0,0 +1,292 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	k8spatch "k8s.io/apimachinery/pkg/util/strategicpatch"
+	"reflect"
+	"sort"
+)
+
+// ChangeType tells whether a resource or field was added, removed or changed.
+type ChangeType string
+
+const (
+	AddedChange   ChangeType = "added"
+	RemovedChange ChangeType = "removed"
+	ChangedChange ChangeType = "changed"
+)
+
+// ResourceDiff describes how a resource, matched by identity, differs between two manifest sets.
+type ResourceDiff struct {
+	Group string `json:"group,omitempty"`
+	// Version is the API version of the resource in the new set, or in the old set for removed resources
+	Version   string     `json:"version"`
+	Kind      string     `json:"kind"`
+	Namespace string     `json:"namespace,omitempty"`
+	Name      string     `json:"name"`
+	Change    ChangeType `json:"change"`
+	// OldSource and NewSource are where the resource was read from in each set, empty when unknown or absent
+	OldSource string `json:"oldSource,omitempty"`
+	NewSource string `json:"newSource,omitempty"`
+	// Strategy is the patch semantics the resource was compared with, JSONMergePatchStrategy for kinds without a schema
+	Strategy PatchStrategy `json:"strategy,omitempty"`
+	Fields   []FieldDiff   `json:"fields,omitempty"`
+	// Patch turns the old resource into the new one
+	Patch JSONObject `json:"patch,omitempty"`
+}
+
+// Identity returns the group, kind, namespace and name that the resource was matched by.
+func (d ResourceDiff) Identity() ResourceIdentity {
+	return ResourceIdentity{Group: d.Group, Kind: d.Kind, Namespace: d.Namespace, Name: d.Name}
+}
+
+// FieldDiff is a field or list item that differs between two versions of a resource. Items of lists merged by key
+// are addressed by their merge key, as in `.spec.containers[name=web]`, and items of merged lists of scalars by
+// their value. Old is null for added fields and New for removed ones; the change tells them apart from explicit nulls,
+// which are always encoded.
+type FieldDiff struct {
+	Path   string     `json:"path"`
+	Change ChangeType `json:"change"`
+	Old    JSONValue  `json:"old"`
+	New    JSONValue  `json:"new"`
+}
+
+// DiffManifests matches the resources of two manifest sets by group, kind, namespace and name, and reports those that
+// were added, removed or changed. Fields are compared with the patch metadata of each kind, so the order of keys and of
+// the items of merged lists does not count as a change. Kinds without a schema are compared with JSON merge patch
+// semantics, where lists only change as a whole.
+func DiffManifests(sc *SchemaClient, oldDocuments []ManifestDocument, newDocuments []ManifestDocument) ([]ResourceDiff, error) {
+	oldResources, oldOrder, err := indexResources(oldDocuments)
+	if err != nil {
+		return nil, err
+	}
+	newResources, newOrder, err := indexResources(newDocuments)
+	if err != nil {
+		return nil, err
+	}
+	result := []ResourceDiff{}
+	for _, identity := range oldOrder {
+		oldDocument := oldResources[identity]
+		newDocument, ok := newResources[identity]
+		if !ok {
+			diff := newResourceDiff(identity, oldDocument.Object, RemovedChange)
+			diff.OldSource = describeSource(oldDocument.Position)
+			result = append(result, diff)
+			continue
+		}
+		diff, err := diffResource(sc, identity, oldDocument, newDocument)
+		if err != nil {
+			return nil, err
+		}
+		if len(diff.Fields) > 0 {
+			result = append(result, diff)
+		}
+	}
+	for _, identity := range newOrder {
+		if _, ok := oldResources[identity]; !ok {
+			newDocument := newResources[identity]
+			diff := newResourceDiff(identity, newDocument.Object, AddedChange)
+			diff.NewSource = describeSource(newDocument.Position)
+			result = append(result, diff)
+		}
+	}
+	return result, nil
+}
+
+// indexResources indexes documents by identity, returning the identities in input order.
+func indexResources(documents []ManifestDocument) (map[ResourceIdentity]ManifestDocument, []ResourceIdentity, error) {
+	index := map[ResourceIdentity]ManifestDocument{}
+	order := []ResourceIdentity{}
+	locations := map[ResourceIdentity]string{}
+	for i, document := range documents {
+		location := describeLocation(i, document.Position)
+		identity, err := GetResourceIdentity(document.Object)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", location, err)
+		}
+		if previous, ok := locations[identity]; ok {
+			return nil, nil, fmt.Errorf("%s (%s): duplicates %s", location, identity.String(), previous)
+		}
+		locations[identity] = location
+		index[identity] = document
+		order = append(order, identity)
+	}
+	return index, order, nil
+}
+
+func newResourceDiff(identity ResourceIdentity, resource JSONObject, change ChangeType) ResourceDiff {
+	version := ""
+	if gvk, err := ComputeGVK(resource); err == nil {
+		version = gvk.Version
+	}
+	return ResourceDiff{
+		Group:     identity.Group,
+		Version:   version,
+		Kind:      identity.Kind,
+		Namespace: identity.Namespace,
+		Name:      identity.Name,
+		Change:    change,
+	}
+}
+
+func describeSource(position SourcePosition) string {
+	if position.Line == 0 {
+		return ""
+	}
+	return position.String()
+}
+
+func diffResource(sc *SchemaClient, identity ResourceIdentity, oldDocument ManifestDocument, newDocument ManifestDocument) (ResourceDiff, error) {
+	diff := newResourceDiff(identity, newDocument.Object, ChangedChange)
+	diff.OldSource = describeSource(oldDocument.Position)
+	diff.NewSource = describeSource(newDocument.Position)
+	diff.Strategy = StrategicMergePatchStrategy
+	gvk, err := ComputeGVK(newDocument.Object)
+	if err != nil {
+		return ResourceDiff{}, err
+	}
+	lookupMeta, err := sc.GetPatchMetadata(*gvk)
+	if err != nil {
+		diff.Strategy = JSONMergePatchStrategy
+		lookupMeta = jsonMergePatchMeta
+	}
+	for _, document := range []ManifestDocument{oldDocument, newDocument} {
+		err = checkMergeKeys(document.Object, "", lookupMeta)
+		if err != nil {
+			return ResourceDiff{}, locateError(err, *gvk, PatchSource{identity: identity, provenance: Provenance{Position: document.Position}})
+		}
+	}
+	diff.Fields, err = diffObjects("", oldDocument.Object, newDocument.Object, lookupMeta)
+	if err != nil {
+		return ResourceDiff{}, err
+	}
+	if len(diff.Fields) == 0 {
+		return diff, nil
+	}
+	diff.Patch, err = calculatePatch(oldDocument.Object, newDocument.Object, lookupMeta)
+	if err != nil {
+		location := ResourceLocation{GVK: *gvk, Name: identity.QualifiedName(), Position: newDocument.Position}
+		return ResourceDiff{}, fmt.Errorf("%s: %w", location, err)
+	}
+	return diff, nil
+}
+
+func diffObjects(path string, oldObject JSONObject, newObject JSONObject, lookupMeta k8spatch.LookupPatchMeta) ([]FieldDiff, error) {
+	keys := []string{}
+	for k := range oldObject {
+		keys = append(keys, k)
+	}
+	for k := range newObject {
+		if _, ok := oldObject[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	result := []FieldDiff{}
+	for _, k := range keys {
+		fieldPath := appendFieldPath(path, k)
+		oldValue, inOld := oldObject[k]
+		newValue, inNew := newObject[k]
+		if !inOld {
+			result = append(result, FieldDiff{Path: fieldPath, Change: AddedChange, New: newValue})
+			continue
+		}
+		if !inNew {
+			result = append(result, FieldDiff{Path: fieldPath, Change: RemovedChange, Old: oldValue})
+			continue
+		}
+		switch typedOld := oldValue.(type) {
+		case JSONObject:
+			if typedNew, ok := newValue.(JSONObject); ok {
+				fieldMeta, _, err := lookupMeta.LookupPatchMetadataForStruct(k)
+				if err != nil {
+					fieldMeta = jsonMergePatchMeta
+				}
+				fields, err := diffObjects(fieldPath, typedOld, typedNew, fieldMeta)
+				if err != nil {
+					return nil, err
+				}
+				result = append(result, fields...)
+				continue
+			}
+		case JSONArray:
+			if typedNew, ok := newValue.(JSONArray); ok {
+				itemMeta, patchMeta, err := lookupMeta.LookupPatchMetadataForSlice(k)
+				if err == nil && shouldSubtractList(patchMeta) {
+					fields, err := diffMergedLists(fieldPath, typedOld, typedNew, patchMeta.GetPatchMergeKey(), itemMeta)
+					if err != nil {
+						return nil, err
+					}
+					result = append(result, fields...)
+					continue
+				}
+			}
+		}
+		if !reflect.DeepEqual(oldValue, newValue) {
+			result = append(result, FieldDiff{Path: fieldPath, Change: ChangedChange, Old: oldValue, New: newValue})
+		}
+	}
+	return result, nil
+}
+
+// diffMergedLists compares the items of lists that patches merge rather than replace, ignoring their order. Items are
+// matched by merge key, or by value for lists of scalars.
+func diffMergedLists(path string, oldList JSONArray, newList JSONArray, mergeKey string, itemMeta k8spatch.LookupPatchMeta) ([]FieldDiff, error) {
+	itemPath := func(item JSONValue) string {
+		if typedItem, ok := item.(JSONObject); ok && mergeKey != "" {
+			return fmt.Sprintf("%s[%s=%s]", path, mergeKey, formatListKey(typedItem[mergeKey]))
+		}
+		return fmt.Sprintf("%s[%s]", path, formatListKey(item))
+	}
+	matches := func(a JSONValue, b JSONValue) bool {
+		typedA, okA := a.(JSONObject)
+		typedB, okB := b.(JSONObject)
+		if okA && okB && mergeKey != "" {
+			return reflect.DeepEqual(typedA[mergeKey], typedB[mergeKey])
+		}
+		return reflect.DeepEqual(a, b)
+	}
+	find := func(list JSONArray, item JSONValue) (JSONValue, bool) {
+		for _, candidate := range list {
+			if matches(candidate, item) {
+				return candidate, true
+			}
+		}
+		return nil, false
+	}
+	result := []FieldDiff{}
+	for _, oldItem := range oldList {
+		newItem, ok := find(newList, oldItem)
+		if !ok {
+			result = append(result, FieldDiff{Path: itemPath(oldItem), Change: RemovedChange, Old: oldItem})
+			continue
+		}
+		typedOld, okOld := oldItem.(JSONObject)
+		typedNew, okNew := newItem.(JSONObject)
+		if okOld && okNew {
+			fields, err := diffObjects(itemPath(oldItem), typedOld, typedNew, itemMeta)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, fields...)
+		} else if !reflect.DeepEqual(oldItem, newItem) {
+			result = append(result, FieldDiff{Path: itemPath(oldItem), Change: ChangedChange, Old: oldItem, New: newItem})
+		}
+	}
+	for _, newItem := range newList {
+		if _, ok := find(oldList, newItem); !ok {
+			result = append(result, FieldDiff{Path: itemPath(newItem), Change: AddedChange, New: newItem})
+		}
+	}
+	return result, nil
+}
+
+// formatListKey renders a merge key or scalar list item for a field path: strings as they are, anything else as JSON.
+func formatListKey(v JSONValue) string {
+	if typed, ok := v.(string); ok {
+		return typed
+	}
+	content, _ := json.Marshal(v)
+	return string(content)
+}
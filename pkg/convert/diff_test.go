@@ -0,0 +1,119 @@
+package convert
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_DiffManifests(t *testing.T) {
+	oldManifests := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:1.0
+        args: [--verbose]
+      - name: sidecar
+        image: proxy:1.0
+      - name: legacy
+        image: legacy:1.0
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: removed
+data:
+  key: value
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unchanged
+data:
+  first: one
+  second: two
+`
+	newManifests := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: unchanged
+data:
+  second: two
+  first: one
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: sidecar
+        image: proxy:1.0
+      - name: web
+        image: web:2.0
+        args: [--quiet]
+      - name: metrics
+        image: metrics:1.0
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: added
+`
+	oldDocuments, err := ReadManifestDocuments(strings.NewReader(oldManifests), "old.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	newDocuments, err := ReadManifestDocuments(strings.NewReader(newManifests), "new.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	diffs, err := DiffManifests(sc, oldDocuments, newDocuments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(diffs) != 3 {
+		t.Fatalf("expected 3 resource diffs, got %v", diffs)
+	}
+	web := diffs[0]
+	if web.Name != "web" || web.Change != ChangedChange || web.Strategy != StrategicMergePatchStrategy || web.NewSource != "new.yaml:9 (document 2)" {
+		t.Fatalf("unexpected resource diff: %v", web)
+	}
+	expectedFields := []FieldDiff{
+		{Path: ".spec.replicas", Change: ChangedChange, Old: 1.0, New: 3.0},
+		{Path: ".spec.template.spec.containers[name=web].args", Change: ChangedChange, Old: JSONArray{"--verbose"}, New: JSONArray{"--quiet"}},
+		{Path: ".spec.template.spec.containers[name=web].image", Change: ChangedChange, Old: "web:1.0", New: "web:2.0"},
+		{Path: ".spec.template.spec.containers[name=legacy]", Change: RemovedChange, Old: JSONObject{"name": "legacy", "image": "legacy:1.0"}},
+		{Path: ".spec.template.spec.containers[name=metrics]", Change: AddedChange, New: JSONObject{"name": "metrics", "image": "metrics:1.0"}},
+	}
+	if !reflect.DeepEqual(web.Fields, expectedFields) {
+		t.Fatalf("unexpected field diffs: %#v", web.Fields)
+	}
+	if web.Patch == nil {
+		t.Fatal("expected a patch for the changed resource")
+	}
+	if diffs[1].Name != "removed" || diffs[1].Change != RemovedChange || diffs[1].OldSource == "" {
+		t.Fatalf("unexpected resource diff: %v", diffs[1])
+	}
+	if diffs[2].Name != "added" || diffs[2].Group != "example.com" || diffs[2].Change != AddedChange {
+		t.Fatalf("unexpected resource diff: %v", diffs[2])
+	}
+
+	_, err = DiffManifests(sc, append(oldDocuments, oldDocuments[1]), newDocuments)
+	if err == nil || !strings.Contains(err.Error(), "duplicates") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,349 @@
+package convert
+
+import (
+	"bytes"
+	"encoding/json"
+	"gopkg.in/yaml.v3"
+	k8spatch "k8s.io/apimachinery/pkg/util/strategicpatch"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// listItemsKey stands for the items of a list in a keyOrder, which all share the same key order. Scalar styles are
+// recorded per item as well, as items of the same list are often written differently, and found again by merge key,
+// or by value for lists of strings.
+const listItemsKey = "[]"
+
+// conventionalKeys are emitted before any other key of the mapping at the same path, in this order
+var conventionalKeys = map[string][]string{
+	"":          {"apiVersion", "kind", "metadata", "spec"},
+	".metadata": {"name", "generateName", "namespace", "labels", "annotations"},
+}
+
+// keyOrder records the order in which mapping keys first appear, and the style of the first scalar seen, for every
+// path of a set of documents.
+type keyOrder struct {
+	keys     []string
+	children map[string]*keyOrder
+	// items holds every item seen in the list, in order of appearance
+	items []*keyOrder
+	// fields holds the scalar fields of a list item, which identify it by merge key
+	fields map[string]string
+	// value holds the value of a string list item
+	value *string
+	style yaml.Style
+}
+
+func newKeyOrder() *keyOrder {
+	return &keyOrder{children: map[string]*keyOrder{}}
+}
+
+// add merges the key order of a YAML node, appending keys that were not seen yet.
+func (o *keyOrder) add(node *yaml.Node) {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key := node.Content[i].Value
+			o.child(key).add(node.Content[i+1])
+		}
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			o.child(listItemsKey).add(item)
+			o.items = append(o.items, newItemOrder(item))
+		}
+	case yaml.ScalarNode:
+		if o.style == 0 && node.Tag == "!!str" {
+			o.style = node.Style & (yaml.DoubleQuotedStyle | yaml.SingleQuotedStyle | yaml.LiteralStyle | yaml.FoldedStyle)
+		}
+	}
+}
+
+// newItemOrder records the order and styles of a list item along with what identifies it.
+func newItemOrder(node *yaml.Node) *keyOrder {
+	if node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	result := newKeyOrder()
+	result.add(node)
+	switch node.Kind {
+	case yaml.MappingNode:
+		result.fields = map[string]string{}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if value := node.Content[i+1]; value.Kind == yaml.ScalarNode {
+				result.fields[node.Content[i].Value] = value.Value
+			}
+		}
+	case yaml.ScalarNode:
+		if node.Tag == "!!str" {
+			value := node.Value
+			result.value = &value
+		}
+	}
+	return result
+}
+
+// merge appends the keys of other that were not seen yet, and takes the styles of other where none was recorded.
+func (o *keyOrder) merge(other *keyOrder) {
+	if other == nil {
+		return
+	}
+	if o.style == 0 {
+		o.style = other.style
+	}
+	for _, key := range other.keys {
+		o.child(key)
+	}
+	for key, child := range other.children {
+		o.child(key).merge(child)
+	}
+	o.items = append(o.items, other.items...)
+}
+
+// mergeKeys appends the keys of other that were not seen yet, leaving styles as they are.
+func (o *keyOrder) mergeKeys(other *keyOrder) {
+	if other == nil {
+		return
+	}
+	for _, key := range other.keys {
+		o.child(key)
+	}
+	for key, child := range other.children {
+		o.child(key).mergeKeys(child)
+	}
+}
+
+func (o *keyOrder) child(key string) *keyOrder {
+	child, ok := o.children[key]
+	if !ok {
+		child = newKeyOrder()
+		o.children[key] = child
+		if key != listItemsKey {
+			o.keys = append(o.keys, key)
+		}
+	}
+	return child
+}
+
+func (o *keyOrder) lookup(key string) *keyOrder {
+	if o == nil {
+		return nil
+	}
+	return o.children[key]
+}
+
+// lookupItem returns the order of a list item: the keys and styles of the first item seen with the same merge key
+// value, or the same value for strings, followed by the keys seen in any item of the list. Items that cannot be
+// identified take the keys and styles shared by every item of the list.
+func (o *keyOrder) lookupItem(item JSONValue, mergeKey string) *keyOrder {
+	if o == nil {
+		return nil
+	}
+	shared := o.children[listItemsKey]
+	seen := o.findItem(item, mergeKey)
+	if seen == nil {
+		return shared
+	}
+	result := newKeyOrder()
+	result.merge(seen)
+	result.mergeKeys(shared)
+	return result
+}
+
+func (o *keyOrder) findItem(item JSONValue, mergeKey string) *keyOrder {
+	switch typed := item.(type) {
+	case JSONObject:
+		value, ok := scalarText(typed[mergeKey])
+		if mergeKey == "" || !ok {
+			return nil
+		}
+		for _, seen := range o.items {
+			if seenValue, ok := seen.fields[mergeKey]; ok && seenValue == value {
+				return seen
+			}
+		}
+	case string:
+		for _, seen := range o.items {
+			if seen.value != nil && *seen.value == typed {
+				return seen
+			}
+		}
+	}
+	return nil
+}
+
+// scalarText returns the text of a scalar as it appears in YAML.
+func scalarText(v JSONValue) (string, bool) {
+	switch typed := v.(type) {
+	case string:
+		return typed, true
+	case json.Number:
+		return typed.String(), true
+	case bool:
+		return strconv.FormatBool(typed), true
+	}
+	return "", false
+}
+
+func (o *keyOrder) scalarStyle() yaml.Style {
+	if o == nil {
+		return 0
+	}
+	return o.style
+}
+
+func (o *keyOrder) index(key string) int {
+	if o != nil {
+		for i, k := range o.keys {
+			if k == key {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// MarshalYAML encodes a value as YAML, emitting the conventional keys of Kubernetes resources first, multi-line
+// strings as block scalars and other keys in alphabetical order.
+func MarshalYAML(v any) ([]byte, error) {
+	return marshalOrderedYAML(v, nil, nil)
+}
+
+// marshalOrderedYAML encodes a value as YAML, emitting mapping keys in conventional order first, then in the
+// given key order, then alphabetically. Strings keep the quoting or block style recorded for their path, and list
+// items the ones recorded for the item with the same merge key, which lookupMeta gives.
+func marshalOrderedYAML(v any, order *keyOrder, lookupMeta k8spatch.LookupPatchMeta) ([]byte, error) {
+	value, err := toJSONValue(v)
+	if err != nil {
+		return nil, err
+	}
+	buffer := bytes.Buffer{}
+	encoder := yaml.NewEncoder(&buffer)
+	encoder.SetIndent(2)
+	err = encoder.Encode(toYAMLNode(value, "", order, lookupMeta, ""))
+	if err != nil {
+		return nil, err
+	}
+	err = encoder.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+// toJSONValue converts typed values, such as JSON patch operations, into their generic JSON representation. Numbers
+// are kept as json.Number so that large integers are emitted unchanged.
+func toJSONValue(v any) (JSONValue, error) {
+	jsonContent, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(jsonContent))
+	decoder.UseNumber()
+	var value JSONValue
+	err = decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// toYAMLNode converts a value into a YAML node. lookupMeta is the patch metadata of the value, and mergeKey the merge
+// key of its items if it is a list.
+func toYAMLNode(v JSONValue, path string, order *keyOrder, lookupMeta k8spatch.LookupPatchMeta, mergeKey string) *yaml.Node {
+	switch typed := v.(type) {
+	case JSONObject:
+		node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		for _, key := range sortKeys(typed, path, order) {
+			childOrder := order.lookup(key)
+			childMeta, childMergeKey := lookupFieldPatchMeta(lookupMeta, childOrder, key, typed[key])
+			node.Content = append(node.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+				toYAMLNode(typed[key], path+"."+key, childOrder, childMeta, childMergeKey),
+			)
+		}
+		return node
+	case JSONArray:
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, item := range typed {
+			node.Content = append(node.Content, toYAMLNode(item, path+listItemsKey, order.lookupItem(item, mergeKey), lookupMeta, ""))
+		}
+		return node
+	case string:
+		multiline := strings.Contains(strings.TrimRight(typed, "\n"), "\n")
+		node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: typed, Style: order.scalarStyle()}
+		if node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 && !multiline {
+			// a block style recorded from another value would turn a single line into a block scalar
+			node.Style = 0
+		}
+		if node.Style == 0 && multiline {
+			node.Style = yaml.LiteralStyle
+		}
+		return node
+	case json.Number:
+		if _, err := typed.Int64(); err == nil {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: typed.String()}
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: typed.String()}
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: strconv.FormatBool(typed)}
+	}
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}
+}
+
+// lookupFieldPatchMeta returns the patch metadata of a field, and the merge key of its items if it is a list. Fields
+// without recorded styles need neither.
+func lookupFieldPatchMeta(lookupMeta k8spatch.LookupPatchMeta, order *keyOrder, key string, value JSONValue) (k8spatch.LookupPatchMeta, string) {
+	if lookupMeta == nil || order == nil {
+		return nil, ""
+	}
+	switch value.(type) {
+	case JSONObject:
+		fieldMeta, _, err := lookupMeta.LookupPatchMetadataForStruct(key)
+		if err != nil {
+			return nil, ""
+		}
+		return fieldMeta, ""
+	case JSONArray:
+		itemMeta, patchMeta, err := lookupMeta.LookupPatchMetadataForSlice(key)
+		if err != nil {
+			return nil, ""
+		}
+		return itemMeta, patchMeta.GetPatchMergeKey()
+	}
+	return nil, ""
+}
+
+func sortKeys(object JSONObject, path string, order *keyOrder) []string {
+	conventional := conventionalKeys[path]
+	rank := func(key string) (int, int) {
+		for i, k := range conventional {
+			if k == key {
+				return 0, i
+			}
+		}
+		if i := order.index(key); i >= 0 {
+			return 1, i
+		}
+		return 2, 0
+	}
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		groupI, indexI := rank(keys[i])
+		groupJ, indexJ := rank(keys[j])
+		if groupI != groupJ {
+			return groupI < groupJ
+		}
+		if indexI != indexJ {
+			return indexI < indexJ
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
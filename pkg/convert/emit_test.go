@@ -0,0 +1,171 @@
+package convert
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func Test_OrderedYAML(t *testing.T) {
+	documents, err := ReadManifestDocuments(strings.NewReader(`kind: ConfigMap
+metadata:
+  name: first
+  labels:
+    zone: a
+    app: web
+apiVersion: v1
+data:
+  version: "1"
+  script: |
+    #!/bin/sh
+    echo first
+  mode: 'strict'
+---
+kind: ConfigMap
+apiVersion: v1
+metadata:
+  name: second
+  labels:
+    zone: b
+    app: web
+data:
+  version: "1"
+  script: |
+    #!/bin/sh
+    echo second
+  mode: 'strict'
+`), "ordered.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).ExecuteDocuments(context.Background(), documents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	originals, err := results[0].GetOriginalYAMLs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+  labels:
+    zone: a
+    app: web
+data:
+  version: "1"
+  script: |
+    #!/bin/sh
+    echo first
+  mode: 'strict'
+`
+	if string(originals[0]) != expected {
+		t.Fatalf("unexpected original YAML:\n%s", originals[0])
+	}
+	base, err := results[0].GetBaseYAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(base), "apiVersion: v1\nkind: ConfigMap\nmetadata:\n") {
+		t.Fatalf("unexpected base YAML:\n%s", base)
+	}
+	content, err := marshalOrderedYAML(documents[0].Object, results[0].order, results[0].patchMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != expected {
+		t.Fatalf("unexpected YAML from the partition key order:\n%s", content)
+	}
+
+	documents, err = ReadManifestDocuments(strings.NewReader(`apiVersion: v1
+kind: Pod
+metadata:
+  name: styled
+spec:
+  containers:
+  - name: first
+    args: ['--a', "--b", --c]
+    command:
+    - |
+      run
+      first
+  - name: second
+    command:
+    - run second
+`), "styled.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err = marshalOrderedYAML(documents[0].Object, documents[0].order, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedStyled := `apiVersion: v1
+kind: Pod
+metadata:
+  name: styled
+spec:
+  containers:
+    - name: first
+      args:
+        - '--a'
+        - "--b"
+        - --c
+      command:
+        - |
+          run
+          first
+    - name: second
+      command:
+        - run second
+`
+	if string(content) != expectedStyled {
+		t.Fatalf("unexpected styles of list items:\n%s", content)
+	}
+	documents, err = ReadManifestDocuments(strings.NewReader(`apiVersion: v1
+kind: Pod
+metadata:
+  name: first
+spec:
+  containers:
+  - name: app
+    image: 'app:1.0'
+  - name: "sidecar"
+    image: "proxy:1.0"
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: second
+spec:
+  containers:
+  - name: app
+    image: 'app:1.0'
+`), "keyed.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).ExecuteDocuments(context.Background(), documents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches, err := results[0].GetPatchYAMLs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patches) != 2 || !strings.Contains(string(patches[0]), "\n    - name: \"sidecar\"\n      image: \"proxy:1.0\"\n") {
+		t.Fatalf("expected the patch item to keep the styles of the item with the same merge key:\n%s", patches[0])
+	}
+	content, err = MarshalYAML(JSONObject{"spec": JSONObject{"replicas": 3.0}, "kind": "Deployment", "b": "x\ny", "a": "10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "kind: Deployment\nspec:\n  replicas: 3\na: \"10\"\nb: |-\n  x\n  y\n" {
+		t.Fatalf("unexpected YAML:\n%s", content)
+	}
+}
@@ -1,6 +1,7 @@
 package convert
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
 	"errors"
@@ -8,48 +9,240 @@ import (
 	"gopkg.in/yaml.v3"
 	"io"
 	k8syaml "sigs.k8s.io/yaml"
+	"strings"
 )
 
 func ParseYAMLFileIntoJSONObjects(y []byte) ([]JSONObject, error) {
-	result := make([]JSONObject, 0)
-	reader := bytes.NewReader(y)
-	decoder := yaml.NewDecoder(reader)
+	documents, err := ReadManifestDocuments(bytes.NewReader(y), "")
+	if err != nil {
+		return nil, err
+	}
+	return ManifestObjects(documents), nil
+}
+
+// StdinFileName names the standard input in source positions.
+const StdinFileName = "<stdin>"
+
+// SourcePosition locates a manifest document within its input.
+type SourcePosition struct {
+	// File is the name of the input, empty when unknown
+	File string
+	// Document is the 1-based index of the document within the input, counting empty documents
+	Document int
+	// Line is the 1-based line the document content starts at
+	Line int
+}
+
+func (p SourcePosition) String() string {
+	file := p.File
+	if file == "" {
+		file = "<input>"
+	}
+	return fmt.Sprintf("%s:%d (document %d)", file, p.Line, p.Document)
+}
+
+// ManifestDocument is a resource decoded from a manifest stream, along with where it was found.
+type ManifestDocument struct {
+	Object   JSONObject
+	Position SourcePosition
+	// Comment holds the comment lines preceding the document content, without their '#' markers
+	Comment string
+	order   *keyOrder
+}
+
+// ManifestDecoder reads resources one YAML document at a time from a stream of manifests. Documents are split on
+// `---` lines rather than by the YAML decoder, which would attach comments following a separator to the previous document.
+type ManifestDecoder struct {
+	reader   *bufio.Reader
+	file     string
+	document int
+	line     int
+	pending  string
+	started  bool
+	eof      bool
+}
+
+func NewManifestDecoder(r io.Reader, file string) *ManifestDecoder {
+	return &ManifestDecoder{
+		reader: bufio.NewReader(r),
+		file:   file,
+	}
+}
+
+// Next returns the next non-empty document of the stream, or io.EOF once the stream is exhausted.
+func (d *ManifestDecoder) Next() (ManifestDocument, error) {
 	for {
-		var yamlObj map[string]interface{}
-		err := decoder.Decode(&yamlObj)
-		if errors.Is(err, io.EOF) {
-			break
+		content, startLine, err := d.readDocument()
+		if err != nil {
+			return ManifestDocument{}, err
 		}
+		d.document++
+		position := SourcePosition{File: d.file, Document: d.document, Line: startLine}
+		var node yaml.Node
+		err = yaml.Unmarshal(content, &node)
 		if err != nil {
-			return nil, err
+			return ManifestDocument{}, &InvalidDocumentError{ResourceLocation{Position: position}, err}
 		}
-		if yamlObj == nil {
-			break
+		if len(node.Content) == 0 {
+			continue
 		}
-		yy, err := yaml.Marshal(yamlObj)
-		if err != nil {
-			return nil, err
+		root := node.Content[0]
+		position.Line = startLine + root.Line - 1
+		if root.Tag == "!!null" {
+			continue
 		}
-		jsonBytes, err := k8syaml.YAMLToJSONStrict(yy)
-		if err != nil {
-			return nil, err
+		if root.Kind != yaml.MappingNode {
+			return ManifestDocument{}, &NonObjectDocumentError{ResourceLocation{Position: position}}
 		}
-		var jsonObj any
-		err = json.Unmarshal(jsonBytes, &jsonObj)
+		object, err := decodeJSONObject(root)
 		if err != nil {
-			return nil, err
+			return ManifestDocument{}, &InvalidDocumentError{ResourceLocation{Position: position}, err}
+		}
+		if len(object) == 0 {
+			continue
 		}
-		switch typedJSONObj := jsonObj.(type) {
-		case JSONObject:
-			if len(typedJSONObj) == 0 {
+		order := newKeyOrder()
+		order.add(root)
+		return ManifestDocument{Object: object, Position: position, Comment: leadingComment(content), order: order}, nil
+	}
+}
+
+// readDocument returns the text of the next document and the line it starts at. Comments and blank lines
+// preceding the first separator of the stream do not form a document. A separator followed by content on the same
+// line, such as a tag or a comment, starts the next document as is, leaving the YAML decoder to accept or reject it.
+func (d *ManifestDecoder) readDocument() ([]byte, int, error) {
+	for {
+		if d.eof {
+			return nil, 0, io.EOF
+		}
+		buffer := bytes.Buffer{}
+		startLine := d.line + 1
+		if d.pending != "" {
+			buffer.WriteString(d.pending)
+			startLine = d.line
+			d.pending = ""
+		}
+		for {
+			line, err := d.reader.ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, 0, err
+			}
+			if line == "" && errors.Is(err, io.EOF) {
+				d.eof = true
+				break
+			}
+			d.line++
+			if rest, ok := cutDocumentSeparator(line); ok {
+				if strings.TrimSpace(rest) != "" {
+					d.pending = line
+				}
+				break
+			}
+			if strings.TrimRight(line, "\r\n") == "..." {
 				continue
 			}
-			result = append(result, typedJSONObj)
-		default:
-			return nil, fmt.Errorf("encountered unexpected non-object type")
+			buffer.WriteString(line)
+			if errors.Is(err, io.EOF) {
+				d.eof = true
+				break
+			}
+		}
+		started := d.started
+		d.started = true
+		if !started && !d.eof && isCommentOnly(buffer.Bytes()) {
+			continue
 		}
+		if d.eof && buffer.Len() == 0 {
+			return nil, 0, io.EOF
+		}
+		return buffer.Bytes(), startLine, nil
+	}
+}
+
+func cutDocumentSeparator(line string) (string, bool) {
+	if !strings.HasPrefix(line, "---") {
+		return "", false
+	}
+	rest := line[3:]
+	if rest == "" || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n' || rest[0] == '\r' {
+		return rest, true
+	}
+	return "", false
+}
+
+func isCommentOnly(content []byte) bool {
+	for _, line := range strings.Split(string(content), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return false
+		}
+	}
+	return true
+}
+
+// leadingComment returns the comment lines that precede the first content line of a document.
+func leadingComment(content []byte) string {
+	lines := []string{}
+	for i, line := range strings.Split(string(content), "\n") {
+		if rest, ok := cutDocumentSeparator(line); ok && i == 0 {
+			line = rest
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			continue
+		}
+		if !strings.HasPrefix(trimmed, "#") {
+			break
+		}
+		lines = append(lines, strings.TrimSpace(strings.TrimPrefix(trimmed, "#")))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ReadManifestDocuments decodes every non-empty document of the stream.
+func ReadManifestDocuments(r io.Reader, file string) ([]ManifestDocument, error) {
+	decoder := NewManifestDecoder(r, file)
+	result := []ManifestDocument{}
+	for {
+		document, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, document)
 	}
-	return result, nil
+}
+
+func ManifestObjects(documents []ManifestDocument) []JSONObject {
+	result := make([]JSONObject, 0, len(documents))
+	for _, document := range documents {
+		result = append(result, document.Object)
+	}
+	return result
+}
+
+func decodeJSONObject(node *yaml.Node) (JSONObject, error) {
+	var yamlObj map[string]interface{}
+	err := node.Decode(&yamlObj)
+	if err != nil {
+		return nil, err
+	}
+	yy, err := yaml.Marshal(yamlObj)
+	if err != nil {
+		return nil, err
+	}
+	jsonBytes, err := k8syaml.YAMLToJSONStrict(yy)
+	if err != nil {
+		return nil, err
+	}
+	var jsonObj JSONObject
+	err = json.Unmarshal(jsonBytes, &jsonObj)
+	if err != nil {
+		return nil, err
+	}
+	return jsonObj, nil
 }
 
 func cloneJSON(o JSONObject) JSONObject {
@@ -58,3 +251,10 @@ func cloneJSON(o JSONObject) JSONObject {
 	_ = json.Unmarshal(sourceBytes, &cloned)
 	return cloned
 }
+
+func cloneJSONValue(v JSONValue) JSONValue {
+	var cloned JSONValue
+	sourceBytes, _ := json.Marshal(v)
+	_ = json.Unmarshal(sourceBytes, &cloned)
+	return cloned
+}
@@ -0,0 +1,77 @@
+package convert
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ReadManifestDocuments(t *testing.T) {
+	documents, err := ReadManifestDocuments(strings.NewReader(`# leading comment
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+---
+---
+# only a comment
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+`), "example.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	positions := []SourcePosition{}
+	for _, document := range documents {
+		positions = append(positions, document.Position)
+	}
+	expected := []SourcePosition{
+		{File: "example.yaml", Document: 1, Line: 2},
+		{File: "example.yaml", Document: 4, Line: 10},
+	}
+	if !reflect.DeepEqual(positions, expected) {
+		t.Fatalf("unexpected positions: %v", positions)
+	}
+	comments, err := ReadManifestDocuments(strings.NewReader("---\n# Source: chart/templates/a.yaml\n\n# second line\napiVersion: v1\nkind: ConfigMap\n--- # Source: chart/templates/b.yaml\napiVersion: v1\nkind: ConfigMap\n"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 || comments[0].Comment != "Source: chart/templates/a.yaml\nsecond line" || comments[1].Comment != "Source: chart/templates/b.yaml" {
+		t.Fatalf("unexpected comments: %v", comments)
+	}
+	if comments[0].Position.Line != 5 || comments[1].Position.Line != 8 {
+		t.Fatalf("unexpected positions: %v", comments)
+	}
+	_, err = ReadManifestDocuments(strings.NewReader("apiVersion: v1\n---\n- a\n- b\n"), "list.yaml")
+	if err == nil || err.Error() != "list.yaml:3 (document 2): encountered unexpected non-object type" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tagged, err := ReadManifestDocuments(strings.NewReader("apiVersion: v1\n--- !!map\napiVersion: v1\nkind: ConfigMap\n"), "tagged.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tagged) != 2 || !reflect.DeepEqual(tagged[1].Object, JSONObject{"apiVersion": "v1", "kind": "ConfigMap"}) || tagged[1].Position.Line != 2 {
+		t.Fatalf("unexpected tagged documents: %v", tagged)
+	}
+	_, err = ReadManifestDocuments(strings.NewReader("apiVersion: v1\n--- |\n  text\n"), "literal.yaml")
+	if err == nil || err.Error() != "literal.yaml:2 (document 2): encountered unexpected non-object type" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = ReadManifestDocuments(strings.NewReader("--- apiVersion: v1\nkind: ConfigMap\n"), "inline.yaml")
+	if err == nil || !strings.HasPrefix(err.Error(), "inline.yaml:1 (document 1): ") {
+		t.Fatalf("expected a mapping on the separator line to be rejected, got: %v", err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	duplicate := append(documents, ManifestDocument{Object: documents[0].Object, Position: SourcePosition{File: "other.yaml", Document: 1, Line: 1}})
+	_, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).ExecuteDocuments(context.Background(), duplicate)
+	if err == nil || err.Error() != "other.yaml:1 (document 1) (/ConfigMap//first): duplicates example.yaml:2 (document 1)" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package convert
+
+import (
+	"context"
+	"fmt"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"os"
+	"path"
+	"strings"
+)
+
+// EnvironmentManifests is a named set of manifests, such as the resources rendered for one environment.
+type EnvironmentManifests struct {
+	Name      string
+	Documents []ManifestDocument
+}
+
+// EnvironmentDecomposition splits the same resources rendered for several environments into a base per resource,
+// holding what every environment agrees on, and a patch per resource and environment.
+type EnvironmentDecomposition struct {
+	environments []string
+	resources    []EnvironmentResource
+}
+
+// EnvironmentResource is a resource matched across environments by group, kind, namespace and name. It is decomposed
+// as a partition whose sources are its variants, one per environment that has it.
+type EnvironmentResource struct {
+	partition    PatchPartition
+	environments []string
+	missing      []string
+}
+
+// Environments returns the names of the environments, in the order they were given.
+func (d *EnvironmentDecomposition) Environments() []string {
+	return append([]string{}, d.environments...)
+}
+
+// Resources returns every resource in order of first appearance, looking at environments in the order they were given.
+func (d *EnvironmentDecomposition) Resources() []EnvironmentResource {
+	return append([]EnvironmentResource{}, d.resources...)
+}
+
+// PartialResources returns the resources that only some of the environments have.
+func (d *EnvironmentDecomposition) PartialResources() []EnvironmentResource {
+	result := []EnvironmentResource{}
+	for _, resource := range d.resources {
+		if len(resource.missing) > 0 {
+			result = append(result, resource)
+		}
+	}
+	return result
+}
+
+// Identity returns the group, kind, namespace and name that the resource is matched by.
+func (er EnvironmentResource) Identity() ResourceIdentity {
+	return er.partition.sources[0].identity
+}
+
+// GVK returns the group, version and kind of the resource, which every environment that has it agrees on.
+func (er EnvironmentResource) GVK() schema.GroupVersionKind {
+	return er.partition.gvk
+}
+
+// Environments returns the names of the environments that have the resource.
+func (er EnvironmentResource) Environments() []string {
+	return append([]string{}, er.environments...)
+}
+
+// MissingEnvironments returns the names of the environments that do not have the resource.
+func (er EnvironmentResource) MissingEnvironments() []string {
+	return append([]string{}, er.missing...)
+}
+
+// Base returns a copy of what every environment that has the resource agrees on.
+func (er EnvironmentResource) Base() JSONObject {
+	return cloneJSON(er.partition.base)
+}
+
+// Variant returns the resource as given for an environment, and the patch that turns the base into it.
+func (er EnvironmentResource) Variant(environment string) (PatchSource, bool) {
+	for i, name := range er.environments {
+		if name == environment {
+			return er.partition.sources[i], true
+		}
+	}
+	return PatchSource{}, false
+}
+
+// fileStem returns a file name for the resource that is unique among all resources.
+func (er EnvironmentResource) fileStem() string {
+	gvk := er.partition.gvk
+	return fmt.Sprintf("%s_%s_%s_%s", gvk.Group, gvk.Version, gvk.Kind, er.Identity().fileStem())
+}
+
+// ExecuteEnvironments matches resources across environments and decomposes every resource into a base and a patch per
+// environment, with the same options as Execute except for layering, which does not apply across environments.
+func (pg *PatchGenerator) ExecuteEnvironments(ctx context.Context, environments []EnvironmentManifests) (*EnvironmentDecomposition, error) {
+	decomposition := &EnvironmentDecomposition{}
+	for _, environment := range environments {
+		if environment.Name == "" || strings.ContainsAny(environment.Name, "/\\") || environment.Name == "." || environment.Name == ".." {
+			return nil, fmt.Errorf("invalid environment name '%s'", environment.Name)
+		}
+		for _, name := range decomposition.environments {
+			if name == environment.Name {
+				return nil, fmt.Errorf("duplicate environment '%s'", environment.Name)
+			}
+		}
+		decomposition.environments = append(decomposition.environments, environment.Name)
+	}
+	normalized := make([]EnvironmentManifests, 0, len(environments))
+	for _, environment := range environments {
+		normalized = append(normalized, EnvironmentManifests{environment.Name, pg.normalize(environment.Documents)})
+	}
+	environments = normalized
+	resources, errs := matchEnvironmentResources(environments)
+	if len(errs) > 0 && !pg.options.ReportAllErrors {
+		return nil, errs[0]
+	}
+	options := pg.options
+	options.LayerSimilarity = 0
+	generator := &PatchGenerator{pg.schemaClient, options}
+	pool := newWorkerPool(options.Workers)
+	resourceErrs := pool.forEach(ctx, len(resources), func(i int) error {
+		return generator.decomposePartition(ctx, pool, &resources[i].partition)
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	for i, resource := range resources {
+		if resourceErrs[i] != nil {
+			sourceErrs := flattenErrors(resourceErrs[i])
+			if !pg.options.ReportAllErrors {
+				return nil, sourceErrs[0]
+			}
+			errs = append(errs, sourceErrs...)
+			continue
+		}
+		for _, name := range decomposition.environments {
+			if _, ok := resource.Variant(name); !ok {
+				resource.missing = append(resource.missing, name)
+			}
+		}
+		decomposition.resources = append(decomposition.resources, resource)
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return decomposition, nil
+}
+
+// matchEnvironmentResources groups the resources of every environment by identity, in order of first appearance.
+// Resources that cannot be identified, that an environment declares twice, or that an environment declares with
+// another version than the first environment that has them, are left out and reported. The base, the patch metadata
+// and the overlay patch targets of a resource all depend on a single version.
+func matchEnvironmentResources(environments []EnvironmentManifests) ([]EnvironmentResource, ErrorList) {
+	resources := []EnvironmentResource{}
+	resourceIndex := map[ResourceIdentity]int{}
+	resourceLocations := map[ResourceIdentity]string{}
+	errs := ErrorList{}
+	for _, environment := range environments {
+		identities := map[ResourceIdentity]string{}
+		for i, document := range environment.Documents {
+			location := fmt.Sprintf("%s: %s", environment.Name, describeLocation(i, document.Position))
+			gvk, err := ComputeGVK(document.Object)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", location, err))
+				continue
+			}
+			identity, err := GetResourceIdentity(document.Object)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s (%s): %w", location, gvk.String(), err))
+				continue
+			}
+			if previous, ok := identities[identity]; ok {
+				errs = append(errs, fmt.Errorf("%s (%s): duplicates %s", location, identity.String(), previous))
+				continue
+			}
+			index, ok := resourceIndex[identity]
+			if ok && resources[index].partition.gvk.Version != gvk.Version {
+				errs = append(errs, fmt.Errorf("%s (%s): version '%s' differs from version '%s' in %s", location, identity.String(), gvk.Version, resources[index].partition.gvk.Version, resourceLocations[identity]))
+				continue
+			}
+			identities[identity] = location
+			if !ok {
+				index = len(resources)
+				resourceIndex[identity] = index
+				resourceLocations[identity] = location
+				resources = append(resources, EnvironmentResource{
+					partition: PatchPartition{
+						gvk:       *gvk,
+						namespace: identity.Namespace,
+						base:      JSONObject{},
+						sources:   []PatchSource{},
+						order:     newKeyOrder(),
+					},
+				})
+			}
+			resource := &resources[index]
+			resource.partition.order.merge(document.order)
+			resource.partition.sources = append(resource.partition.sources, PatchSource{
+				identity: identity,
+				provenance: Provenance{
+					Position: document.Position,
+					Comment:  document.Comment,
+				},
+				original: document.Object,
+				patch:    JSONObject{},
+			})
+			resource.environments = append(resource.environments, environment.Name)
+		}
+	}
+	return resources, errs
+}
+
+// DumpToKustomization writes a `base/` kustomization holding the base of every resource that all environments have,
+// and an `overlays/<environment>/` kustomization per environment that patches those bases and adds the resources that
+// only some environments have, as they are.
+func (d *EnvironmentDecomposition) DumpToKustomization(directoryPath string) error {
+	baseDir := path.Join(directoryPath, "base")
+	err := os.MkdirAll(baseDir, 0755)
+	if err != nil {
+		return err
+	}
+	baseResources := JSONArray{}
+	for _, resource := range d.resources {
+		if len(resource.missing) > 0 {
+			continue
+		}
+		fileName := fmt.Sprintf("%s.yaml", resource.fileStem())
+		yamlContent, err := resource.partition.marshalYAML(resource.partition.base)
+		if err != nil {
+			return err
+		}
+		err = WriteFile(yamlContent, path.Join(baseDir, fileName))
+		if err != nil {
+			return err
+		}
+		baseResources = append(baseResources, fileName)
+	}
+	err = writeKustomization(baseDir, JSONObject{"resources": baseResources})
+	if err != nil {
+		return err
+	}
+	for _, environment := range d.environments {
+		err = d.dumpKustomizationOverlay(path.Join(directoryPath, "overlays", environment), environment)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *EnvironmentDecomposition) dumpKustomizationOverlay(overlayDir string, environment string) error {
+	err := os.MkdirAll(overlayDir, 0755)
+	if err != nil {
+		return err
+	}
+	resources := JSONArray{path.Join("..", "..", "base")}
+	patches := JSONArray{}
+	for _, resource := range d.resources {
+		source, ok := resource.Variant(environment)
+		if !ok {
+			continue
+		}
+		partition := &resource.partition
+		if len(resource.missing) > 0 {
+			fileName := fmt.Sprintf("%s.yaml", resource.fileStem())
+			yamlContent, err := partition.marshalYAML(source.original)
+			if err != nil {
+				return err
+			}
+			err = WriteFile(append(source.provenance.header(), yamlContent...), path.Join(overlayDir, fileName))
+			if err != nil {
+				return err
+			}
+			resources = append(resources, fileName)
+			continue
+		}
+		patch, ok := partition.sourcePatch(source)
+		if !ok {
+			continue
+		}
+		identity := resource.Identity()
+		patch = partition.kustomizePatch(partition.base, source.original, patch)
+		if typedPatch, ok := patch.(JSONObject); ok {
+			patch = kustomizationPatch(partition.base, typedPatch, identity.Name)
+		}
+		fileName := fmt.Sprintf("%s.patch.yaml", resource.fileStem())
+		yamlContent, err := partition.marshalYAML(patch)
+		if err != nil {
+			return err
+		}
+		err = WriteFile(yamlContent, path.Join(overlayDir, fileName))
+		if err != nil {
+			return err
+		}
+		target := JSONObject{
+			"group":   partition.gvk.Group,
+			"version": partition.gvk.Version,
+			"kind":    partition.gvk.Kind,
+			"name":    identity.Name,
+		}
+		if identity.Namespace != "" {
+			target["namespace"] = identity.Namespace
+		}
+		patches = append(patches, JSONObject{"path": fileName, "target": target})
+	}
+	kustomization := JSONObject{"resources": resources}
+	if len(patches) > 0 {
+		kustomization["patches"] = patches
+	}
+	return writeKustomization(overlayDir, kustomization)
+}
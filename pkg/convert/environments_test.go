@@ -0,0 +1,242 @@
+package convert
+
+import (
+	"context"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ExecuteEnvironments(t *testing.T) {
+	manifests := map[string]string{
+		"dev": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:dev
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: debug
+data:
+  level: trace
+`,
+		"prod": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 5
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:1.0
+`,
+	}
+	environments := []EnvironmentManifests{}
+	for _, name := range []string{"dev", "prod"} {
+		documents, err := ReadManifestDocuments(strings.NewReader(manifests[name]), name+".yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		environments = append(environments, EnvironmentManifests{Name: name, Documents: documents})
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decomposition, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).ExecuteEnvironments(context.Background(), environments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := decomposition.Resources()
+	if len(resources) != 2 {
+		t.Fatalf("expected 2 resources, got %d", len(resources))
+	}
+	web := resources[0]
+	expectedBase := JSONObject{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   JSONObject{"name": "web"},
+		"spec": JSONObject{
+			"template": JSONObject{"spec": JSONObject{"containers": JSONArray{JSONObject{"name": "web"}}}},
+		},
+	}
+	if !reflect.DeepEqual(web.Base(), expectedBase) {
+		t.Fatalf("unexpected base: %v", web.Base())
+	}
+	for _, name := range []string{"dev", "prod"} {
+		variant, ok := web.Variant(name)
+		if !ok {
+			t.Fatalf("expected a %s variant", name)
+		}
+		composed, err := Compose(web.Base(), []JSONObject{variant.Patch()}, web.partition.patchMeta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(composed[0], variant.Original()) {
+			t.Fatalf("patch for %s does not reproduce its original: %v", name, composed[0])
+		}
+	}
+	partial := decomposition.PartialResources()
+	if len(partial) != 1 || partial[0].Identity().Name != "debug" || !reflect.DeepEqual(partial[0].MissingEnvironments(), []string{"prod"}) {
+		t.Fatalf("unexpected partial resources: %v", partial)
+	}
+	outputDir := t.TempDir()
+	err = decomposition.DumpToKustomization(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{
+		"base/kustomization.yaml",
+		"base/apps_v1_Deployment_web.yaml",
+		"overlays/dev/kustomization.yaml",
+		"overlays/dev/apps_v1_Deployment_web.patch.yaml",
+		"overlays/dev/_v1_ConfigMap_debug.yaml",
+		"overlays/prod/kustomization.yaml",
+		"overlays/prod/apps_v1_Deployment_web.patch.yaml",
+	} {
+		if _, err := os.Stat(path.Join(outputDir, file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := os.Stat(path.Join(outputDir, "base", "_v1_ConfigMap_debug.yaml")); err == nil {
+		t.Fatal("expected resources missing from some environments to be left out of the base")
+	}
+	staging, err := ReadManifestDocuments(strings.NewReader(`apiVersion: apps/v1beta2
+kind: Deployment
+metadata:
+  name: web
+spec:
+  replicas: 2
+`), "staging.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).ExecuteEnvironments(context.Background(), append(environments, EnvironmentManifests{Name: "staging", Documents: staging}))
+	if err == nil || err.Error() != "staging: staging.yaml:1 (document 1) (apps/Deployment//web): version 'v1beta2' differs from version 'v1' in dev: dev.yaml:1 (document 1)" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).ExecuteEnvironments(context.Background(), append(environments, EnvironmentManifests{Name: "dev"}))
+	if err == nil || err.Error() != "duplicate environment 'dev'" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func Test_EnvironmentsKustomizeBuild(t *testing.T) {
+	manifests := map[string]string{
+		"dev": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: web
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:dev
+        ports:
+        - containerPort: 8080
+          name: http
+          protocol: TCP
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: web
+spec:
+  ports:
+  - port: 80
+    name: http
+    protocol: TCP
+    targetPort: 8080
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: debug
+  namespace: web
+data:
+  level: trace
+`,
+		"prod": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+  namespace: web
+spec:
+  replicas: 5
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:1.0
+        ports:
+        - containerPort: 8080
+          name: web
+          protocol: TCP
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: web
+  namespace: web
+spec:
+  ports:
+  - port: 80
+    name: web
+    protocol: TCP
+    targetPort: 8080
+`,
+	}
+	environments := []EnvironmentManifests{}
+	for _, name := range []string{"dev", "prod"} {
+		documents, err := ReadManifestDocuments(strings.NewReader(manifests[name]), name+".yaml")
+		if err != nil {
+			t.Fatal(err)
+		}
+		environments = append(environments, EnvironmentManifests{Name: name, Documents: documents})
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decomposition, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).ExecuteEnvironments(context.Background(), environments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputDir := t.TempDir()
+	err = decomposition.DumpToKustomization(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, environment := range environments {
+		built := kustomizeBuild(t, path.Join(outputDir, "overlays", environment.Name))
+		expected := ManifestObjects(environment.Documents)
+		if len(built) != len(expected) {
+			t.Fatalf("expected %d resources from the %s overlay, got %v", len(expected), environment.Name, built)
+		}
+		for _, object := range expected {
+			found := false
+			for _, resource := range built {
+				found = found || reflect.DeepEqual(resource, object)
+			}
+			if !found {
+				t.Errorf("%s overlay does not reproduce %v, got %v", environment.Name, object, built)
+			}
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package convert
+
+import (
+	"errors"
+	"fmt"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"strings"
+)
+
+// ResourceLocation identifies the resource an error refers to, the field within it and where it was read from.
+// Any of its fields may be unknown, such as the position of resources given to PatchGenerator.Execute.
+type ResourceLocation struct {
+	GVK      schema.GroupVersionKind
+	Name     string
+	Path     string
+	Position SourcePosition
+}
+
+func (l ResourceLocation) String() string {
+	parts := []string{}
+	if l.Position.Line > 0 {
+		parts = append(parts, l.Position.String())
+	}
+	if l.GVK.Kind != "" {
+		if l.Name != "" {
+			parts = append(parts, fmt.Sprintf("%s '%s'", l.GVK.Kind, l.Name))
+		} else {
+			parts = append(parts, l.GVK.Kind)
+		}
+	}
+	if l.Path != "" {
+		parts = append(parts, fmt.Sprintf("at %s", l.Path))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (l ResourceLocation) describe(message string) string {
+	if location := l.String(); location != "" {
+		return fmt.Sprintf("%s: %s", location, message)
+	}
+	return message
+}
+
+// locatedError is implemented by the errors that carry a ResourceLocation.
+type locatedError interface {
+	error
+	resourceLocation() *ResourceLocation
+}
+
+// locateError fills in the resource details that the code returning err did not know about.
+func locateError(err error, gvk schema.GroupVersionKind, source PatchSource) error {
+	var located locatedError
+	if errors.As(err, &located) {
+		location := located.resourceLocation()
+		if location.GVK.Empty() {
+			location.GVK = gvk
+		}
+		if location.Name == "" {
+			location.Name = source.identity.QualifiedName()
+		}
+		if location.Position.Line == 0 {
+			location.Position = source.provenance.Position
+		}
+	}
+	return err
+}
+
+// SchemaNotFoundError is returned when no schema, and therefore no patch metadata, is known for the kind of a resource.
+type SchemaNotFoundError struct {
+	ResourceLocation
+}
+
+func (e *SchemaNotFoundError) Error() string {
+	return e.describe(fmt.Sprintf("resource schema not found for GVK: %s", e.GVK.String()))
+}
+
+func (e *SchemaNotFoundError) resourceLocation() *ResourceLocation {
+	return &e.ResourceLocation
+}
+
+// MissingMergeKeyError is returned when an item of a list merged by key lacks the merge key declared by its schema.
+// Path points at the list item.
+type MissingMergeKeyError struct {
+	ResourceLocation
+	MergeKey string
+}
+
+func (e *MissingMergeKeyError) Error() string {
+	return e.describe(fmt.Sprintf("missing merge key '%s'", e.MergeKey))
+}
+
+func (e *MissingMergeKeyError) resourceLocation() *ResourceLocation {
+	return &e.ResourceLocation
+}
+
+// UnsharedFieldError is returned when a field that a pin-to-base rule selects differs among the resources of a
+// partition. Path points at the field.
+type UnsharedFieldError struct {
+	ResourceLocation
+	Selector string
+}
+
+func (e *UnsharedFieldError) Error() string {
+	return e.describe(fmt.Sprintf("field pinned to the base by '%s' is not common to every resource", e.Selector))
+}
+
+func (e *UnsharedFieldError) resourceLocation() *ResourceLocation {
+	return &e.ResourceLocation
+}
+
+// NonObjectDocumentError is returned when a manifest document holds something other than a mapping, such as a list.
+type NonObjectDocumentError struct {
+	ResourceLocation
+}
+
+func (e *NonObjectDocumentError) Error() string {
+	return e.describe("encountered unexpected non-object type")
+}
+
+func (e *NonObjectDocumentError) resourceLocation() *ResourceLocation {
+	return &e.ResourceLocation
+}
+
+// InvalidDocumentError is returned when a manifest document is not valid YAML or cannot be represented as JSON.
+type InvalidDocumentError struct {
+	ResourceLocation
+	Err error
+}
+
+func (e *InvalidDocumentError) Error() string {
+	return e.describe(e.Err.Error())
+}
+
+func (e *InvalidDocumentError) Unwrap() error {
+	return e.Err
+}
+
+func (e *InvalidDocumentError) resourceLocation() *ResourceLocation {
+	return &e.ResourceLocation
+}
+
+// ErrorList holds every error of a run that was asked to continue past failing resources.
+type ErrorList []error
+
+func (l ErrorList) Error() string {
+	messages := make([]string, 0, len(l))
+	for _, err := range l {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "\n")
+}
+
+// flattenErrors returns the errors of err if it is an ErrorList, or err alone otherwise.
+func flattenErrors(err error) ErrorList {
+	var errs ErrorList
+	if errors.As(err, &errs) {
+		return errs
+	}
+	return ErrorList{err}
+}
+
+// Unwrap returns the errors of the list, so that errors.Is and errors.As match any of them.
+func (l ErrorList) Unwrap() []error {
+	return l
+}
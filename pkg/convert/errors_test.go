@@ -0,0 +1,65 @@
+package convert
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func Test_LocatedErrors(t *testing.T) {
+	documents, err := ReadManifestDocuments(strings.NewReader(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: web
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app
+      - image: sidecar
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: c
+`), "errors.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).ExecuteDocuments(context.Background(), documents)
+	var missingMergeKey *MissingMergeKeyError
+	if !errors.As(err, &missingMergeKey) {
+		t.Fatalf("expected a MissingMergeKeyError, got %v", err)
+	}
+	if missingMergeKey.Path != ".spec.template.spec.containers[1]" || missingMergeKey.MergeKey != "name" || missingMergeKey.Name != "web" || missingMergeKey.Position.Line != 1 {
+		t.Fatalf("unexpected error location: %+v", missingMergeKey)
+	}
+	if err.Error() != "errors.yaml:1 (document 1) Deployment 'web' at .spec.template.spec.containers[1]: missing merge key 'name'" {
+		t.Fatalf("unexpected error message: %v", err)
+	}
+	_, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{ReportAllErrors: true}).ExecuteDocuments(context.Background(), documents)
+	var errs ErrorList
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected both errors, got %v", err)
+	}
+	var schemaNotFound *SchemaNotFoundError
+	if !errors.As(errs[1], &schemaNotFound) || schemaNotFound.GVK.Kind != "Widget" || schemaNotFound.Name != "w" || schemaNotFound.Position.Line != 13 {
+		t.Fatalf("unexpected error: %v", errs[1])
+	}
+	_, err = ReadManifestDocuments(strings.NewReader("- a\n"), "list.yaml")
+	var nonObject *NonObjectDocumentError
+	if !errors.As(err, &nonObject) || nonObject.Position.Document != 1 {
+		t.Fatalf("expected a NonObjectDocumentError, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package convert
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ResourceIdentity identifies a resource regardless of its API version.
+type ResourceIdentity struct {
+	Group     string
+	Kind      string
+	Namespace string
+	Name      string
+}
+
+func GetResourceIdentity(resource JSONObject) (ResourceIdentity, error) {
+	gvk, err := ComputeGVK(resource)
+	if err != nil {
+		return ResourceIdentity{}, err
+	}
+	name, err := GetResourceName(resource)
+	if err != nil {
+		return ResourceIdentity{}, err
+	}
+	return ResourceIdentity{
+		Group:     gvk.Group,
+		Kind:      gvk.Kind,
+		Namespace: GetResourceNamespace(resource),
+		Name:      name,
+	}, nil
+}
+
+func (ri ResourceIdentity) String() string {
+	return strings.Join([]string{ri.Group, ri.Kind, ri.Namespace, ri.Name}, "/")
+}
+
+// QualifiedName returns the name of the resource, prefixed by its namespace if it has one.
+func (ri ResourceIdentity) QualifiedName() string {
+	if ri.Namespace == "" {
+		return ri.Name
+	}
+	return fmt.Sprintf("%s/%s", ri.Namespace, ri.Name)
+}
+
+// fileStem returns a file name for the resource that is unique among resources of the same kind. Namespaces never
+// contain '_', so the first '_' always ends the namespace and the separator cannot introduce collisions, even though
+// names of some kinds, such as RBAC roles, may contain it.
+func (ri ResourceIdentity) fileStem() string {
+	if ri.Namespace == "" {
+		return ri.Name
+	}
+	return fmt.Sprintf("%s_%s", ri.Namespace, ri.Name)
+}
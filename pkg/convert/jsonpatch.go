@@ -0,0 +1,207 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type PatchFormat string
+
+const (
+	// MergePatchFormat emits strategic merge or JSON merge patches, depending on the partition strategy
+	MergePatchFormat PatchFormat = "merge"
+	// JSON6902PatchFormat emits RFC 6902 JSON Patch operation lists
+	JSON6902PatchFormat PatchFormat = "json6902"
+)
+
+const (
+	jsonPatchAdd     = "add"
+	jsonPatchRemove  = "remove"
+	jsonPatchReplace = "replace"
+)
+
+type JSONPatchOperation struct {
+	Op    string    `json:"op"`
+	Path  string    `json:"path"`
+	Value JSONValue `json:"value,omitempty"`
+}
+
+func (o JSONPatchOperation) MarshalJSON() ([]byte, error) {
+	if o.Op == jsonPatchRemove {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{o.Op, o.Path})
+	}
+	return json.Marshal(struct {
+		Op    string    `json:"op"`
+		Path  string    `json:"path"`
+		Value JSONValue `json:"value"`
+	}{o.Op, o.Path, o.Value})
+}
+
+// createJSONPatch computes the operations that turn a into b. Lists are compared by index: common
+// items are diffed in place, then surplus items are removed from the end or new items appended.
+func createJSONPatch(pointer string, a JSONValue, b JSONValue) []JSONPatchOperation {
+	switch typedA := a.(type) {
+	case JSONObject:
+		if typedB, ok := b.(JSONObject); ok {
+			return createObjectJSONPatch(pointer, typedA, typedB)
+		}
+	case JSONArray:
+		if typedB, ok := b.(JSONArray); ok {
+			return createArrayJSONPatch(pointer, typedA, typedB)
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	return []JSONPatchOperation{{Op: jsonPatchReplace, Path: pointer, Value: b}}
+}
+
+func createObjectJSONPatch(pointer string, a JSONObject, b JSONObject) []JSONPatchOperation {
+	keys := make([]string, 0, len(a)+len(b))
+	for k := range a {
+		keys = append(keys, k)
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	result := []JSONPatchOperation{}
+	for _, k := range keys {
+		keyPointer := appendJSONPointer(pointer, k)
+		aValue, inA := a[k]
+		bValue, inB := b[k]
+		switch {
+		case !inB:
+			result = append(result, JSONPatchOperation{Op: jsonPatchRemove, Path: keyPointer})
+		case !inA:
+			result = append(result, JSONPatchOperation{Op: jsonPatchAdd, Path: keyPointer, Value: bValue})
+		default:
+			result = append(result, createJSONPatch(keyPointer, aValue, bValue)...)
+		}
+	}
+	return result
+}
+
+func createArrayJSONPatch(pointer string, a JSONArray, b JSONArray) []JSONPatchOperation {
+	result := []JSONPatchOperation{}
+	for i := 0; i < len(a) && i < len(b); i++ {
+		result = append(result, createJSONPatch(appendJSONPointer(pointer, strconv.Itoa(i)), a[i], b[i])...)
+	}
+	for i := len(a) - 1; i >= len(b); i-- {
+		result = append(result, JSONPatchOperation{Op: jsonPatchRemove, Path: appendJSONPointer(pointer, strconv.Itoa(i))})
+	}
+	for i := len(a); i < len(b); i++ {
+		result = append(result, JSONPatchOperation{Op: jsonPatchAdd, Path: appendJSONPointer(pointer, strconv.Itoa(i)), Value: b[i]})
+	}
+	return result
+}
+
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+var jsonPointerUnescaper = strings.NewReplacer("~1", "/", "~0", "~")
+
+func appendJSONPointer(pointer string, token string) string {
+	return pointer + "/" + jsonPointerEscaper.Replace(token)
+}
+
+func applyJSONPatch(content JSONObject, operations []JSONPatchOperation) (JSONObject, error) {
+	var result JSONValue = cloneJSON(content)
+	for _, operation := range operations {
+		if operation.Path == "" {
+			return nil, fmt.Errorf("unsupported operation on the document root")
+		}
+		tokens := strings.Split(strings.TrimPrefix(operation.Path, "/"), "/")
+		for i, token := range tokens {
+			tokens[i] = jsonPointerUnescaper.Replace(token)
+		}
+		var err error
+		result, err = applyJSONPatchOperation(result, tokens, operation)
+		if err != nil {
+			return nil, fmt.Errorf("unable to %s '%s': %w", operation.Op, operation.Path, err)
+		}
+	}
+	typedResult, _ := result.(JSONObject)
+	return typedResult, nil
+}
+
+func applyJSONPatchOperation(target JSONValue, tokens []string, operation JSONPatchOperation) (JSONValue, error) {
+	token := tokens[0]
+	last := len(tokens) == 1
+	switch typedTarget := target.(type) {
+	case JSONObject:
+		value, ok := typedTarget[token]
+		if last {
+			switch operation.Op {
+			case jsonPatchAdd:
+				typedTarget[token] = cloneJSONValue(operation.Value)
+			case jsonPatchReplace, jsonPatchRemove:
+				if !ok {
+					return nil, fmt.Errorf("field '%s' not found", token)
+				}
+				if operation.Op == jsonPatchRemove {
+					delete(typedTarget, token)
+				} else {
+					typedTarget[token] = cloneJSONValue(operation.Value)
+				}
+			default:
+				return nil, fmt.Errorf("unsupported operation")
+			}
+			return typedTarget, nil
+		}
+		if !ok {
+			return nil, fmt.Errorf("field '%s' not found", token)
+		}
+		next, err := applyJSONPatchOperation(value, tokens[1:], operation)
+		if err != nil {
+			return nil, err
+		}
+		typedTarget[token] = next
+		return typedTarget, nil
+	case JSONArray:
+		index := len(typedTarget)
+		if token != "-" {
+			parsed, err := strconv.Atoi(token)
+			if err != nil || parsed < 0 || parsed > len(typedTarget) {
+				return nil, fmt.Errorf("invalid list index '%s'", token)
+			}
+			index = parsed
+		}
+		if last {
+			switch operation.Op {
+			case jsonPatchAdd:
+				result := append(JSONArray{}, typedTarget[:index]...)
+				result = append(result, cloneJSONValue(operation.Value))
+				return append(result, typedTarget[index:]...), nil
+			case jsonPatchReplace, jsonPatchRemove:
+				if index >= len(typedTarget) {
+					return nil, fmt.Errorf("list index '%s' out of range", token)
+				}
+				if operation.Op == jsonPatchRemove {
+					return append(append(JSONArray{}, typedTarget[:index]...), typedTarget[index+1:]...), nil
+				}
+				typedTarget[index] = cloneJSONValue(operation.Value)
+				return typedTarget, nil
+			default:
+				return nil, fmt.Errorf("unsupported operation")
+			}
+		}
+		if index >= len(typedTarget) {
+			return nil, fmt.Errorf("list index '%s' out of range", token)
+		}
+		next, err := applyJSONPatchOperation(typedTarget[index], tokens[1:], operation)
+		if err != nil {
+			return nil, err
+		}
+		typedTarget[index] = next
+		return typedTarget, nil
+	}
+	return nil, fmt.Errorf("cannot traverse into a scalar value at '%s'", token)
+}
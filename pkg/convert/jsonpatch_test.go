@@ -0,0 +1,45 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_JSONPatchRoundTrip(t *testing.T) {
+	base := JSONObject{
+		"metadata": JSONObject{"labels": JSONObject{"app.kubernetes.io/name": "a"}},
+		"spec": JSONObject{
+			"args":  JSONArray{"--one", "--two", "--three"},
+			"ports": JSONArray{JSONObject{"port": 80.0}},
+		},
+		"removed": true,
+	}
+	modified := JSONObject{
+		"metadata": JSONObject{"labels": JSONObject{"app.kubernetes.io/name": "b"}},
+		"spec": JSONObject{
+			"args":  JSONArray{"--one"},
+			"ports": JSONArray{JSONObject{"port": 80.0, "name": "http"}, JSONObject{"port": 443.0}},
+		},
+		"creationTimestamp": nil,
+	}
+	operations := createJSONPatch("", base, modified)
+	expected := []JSONPatchOperation{
+		{Op: "add", Path: "/creationTimestamp", Value: nil},
+		{Op: "replace", Path: "/metadata/labels/app.kubernetes.io~1name", Value: "b"},
+		{Op: "remove", Path: "/removed"},
+		{Op: "remove", Path: "/spec/args/2"},
+		{Op: "remove", Path: "/spec/args/1"},
+		{Op: "add", Path: "/spec/ports/0/name", Value: "http"},
+		{Op: "add", Path: "/spec/ports/1", Value: JSONObject{"port": 443.0}},
+	}
+	if !reflect.DeepEqual(operations, expected) {
+		t.Fatalf("unexpected operations: %v", operations)
+	}
+	applied, err := applyJSONPatch(base, operations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(applied, modified) {
+		t.Fatalf("unexpected result: %v", applied)
+	}
+}
@@ -0,0 +1,208 @@
+package convert
+
+import (
+	k8spatch "k8s.io/apimachinery/pkg/util/strategicpatch"
+	"os"
+	"path"
+	"strings"
+)
+
+const (
+	kustomizationFileName   = "kustomization.yaml"
+	kustomizationAPIVersion = "kustomize.config.k8s.io/v1beta1"
+	baseResourceName        = "base"
+
+	deleteFromPrimitiveListPrefix = "$deleteFromPrimitiveList/"
+)
+
+// DumpToKustomization writes a kustomize tree for the given partitions: a `base/` kustomization that
+// includes one directory per partition, a `layers/<partition>/<layer>/` kustomization per layer, and an
+// `overlays/<partition>/<source>/` kustomization per source whose build reproduces the original resource.
+func DumpToKustomization(partitions []PatchPartition, directoryPath string) error {
+	baseDir := path.Join(directoryPath, "base")
+	err := os.MkdirAll(baseDir, 0755)
+	if err != nil {
+		return err
+	}
+	baseResources := JSONArray{}
+	for _, partition := range partitions {
+		err = partition.dumpKustomizationBase(baseDir)
+		if err != nil {
+			return err
+		}
+		err = partition.dumpKustomizationLayers(path.Join(directoryPath, "layers"))
+		if err != nil {
+			return err
+		}
+		err = partition.dumpKustomizationOverlays(path.Join(directoryPath, "overlays"))
+		if err != nil {
+			return err
+		}
+		baseResources = append(baseResources, partition.folderName())
+	}
+	return writeKustomization(baseDir, JSONObject{"resources": baseResources})
+}
+
+// kustomizationResource gives a placeholder name to partition bases and layers whose sources do not share one,
+// as kustomize requires every resource to be named.
+func kustomizationResource(content JSONObject) JSONObject {
+	result := cloneJSON(content)
+	metadata, ok := result["metadata"].(JSONObject)
+	if !ok {
+		metadata = JSONObject{}
+		result["metadata"] = metadata
+	}
+	if _, ok := metadata["name"].(string); !ok {
+		metadata["name"] = baseResourceName
+	}
+	return result
+}
+
+func (pgr *PatchPartition) dumpKustomizationBase(baseDir string) error {
+	partitionDir := path.Join(baseDir, pgr.folderName())
+	err := os.MkdirAll(partitionDir, 0755)
+	if err != nil {
+		return err
+	}
+	yamlContent, err := pgr.marshalYAML(kustomizationResource(pgr.base))
+	if err != nil {
+		return err
+	}
+	err = WriteFile(yamlContent, path.Join(partitionDir, "base.yaml"))
+	if err != nil {
+		return err
+	}
+	return writeKustomization(partitionDir, JSONObject{"resources": JSONArray{"base.yaml"}})
+}
+
+// dumpKustomizationLayers writes a `layers/<partition>/<layer>/` kustomization per layer, which patches its parent layer.
+func (pgr *PatchPartition) dumpKustomizationLayers(layersDir string) error {
+	for _, layer := range pgr.layers {
+		err := pgr.dumpKustomizationPatch(path.Join(layersDir, pgr.folderName(), layer.name), layer.parent, pgr.layerPatch(layer), true, layer.base)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pgr *PatchPartition) dumpKustomizationOverlays(overlaysDir string) error {
+	for _, source := range pgr.sources {
+		patch, ok := pgr.sourcePatch(source)
+		err := pgr.dumpKustomizationPatch(path.Join(overlaysDir, pgr.folderName(), source.identity.fileStem()), source.layer, patch, ok, source.original)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpKustomizationPatch writes a kustomization that builds the named layer, or the partition base, and applies the
+// patch onto it. All layer and overlay directories sit three levels below the kustomize tree root. The kustomization
+// sets the namespace of the content, which a strategic merge patch cannot change in kustomize. Layers without a name
+// keep the placeholder name of the partition base, which RFC 6902 operations would otherwise remove.
+func (pgr *PatchPartition) dumpKustomizationPatch(directoryPath string, layer string, patch JSONValue, hasPatch bool, content JSONObject) error {
+	err := os.MkdirAll(directoryPath, 0755)
+	if err != nil {
+		return err
+	}
+	resource := path.Join("..", "..", "..", "base", pgr.folderName())
+	if layer != "" {
+		resource = path.Join("..", "..", "..", "layers", pgr.folderName(), layer)
+	}
+	kustomization := JSONObject{
+		"resources": JSONArray{resource},
+	}
+	if metadata, ok := content["metadata"].(JSONObject); ok {
+		if namespace, ok := metadata["namespace"].(string); ok && namespace != "" {
+			kustomization["namespace"] = namespace
+		}
+	}
+	if hasPatch {
+		base := kustomizationResource(pgr.layerBase(layer))
+		content = kustomizationResource(content)
+		targetName, _ := GetResourceName(base)
+		patch = pgr.kustomizePatch(base, content, patch)
+		if typedPatch, ok := patch.(JSONObject); ok {
+			name, _ := GetResourceName(content)
+			patch = kustomizationPatch(pgr.base, typedPatch, name)
+		}
+		yamlContent, err := pgr.marshalYAML(patch)
+		if err != nil {
+			return err
+		}
+		err = WriteFile(yamlContent, path.Join(directoryPath, "patch.yaml"))
+		if err != nil {
+			return err
+		}
+		kustomization["patches"] = JSONArray{JSONObject{
+			"path": "patch.yaml",
+			"target": JSONObject{
+				"group":   pgr.gvk.Group,
+				"version": pgr.gvk.Version,
+				"kind":    pgr.gvk.Kind,
+				"name":    targetName,
+			},
+			"options": JSONObject{"allowNameChange": true},
+		}}
+	}
+	return writeKustomization(directoryPath, kustomization)
+}
+
+// kustomizePatch returns the patch to give kustomize for turning base into content, both as kustomize sees them. A
+// strategic merge patch is only given as is when it merges no list items: kustomize replaces the lists of custom
+// resources as a whole, and matches the items of some builtin lists by more keys than the schema merge key, such as
+// ports by port and protocol, so that it drops the fields of patched items and ignores delete directives. Other
+// patches are replaced by the equivalent RFC 6902 operations.
+func (pgr *PatchPartition) kustomizePatch(base JSONObject, content JSONObject, patch JSONValue) JSONValue {
+	if typedPatch, ok := patch.(JSONObject); ok && !pgr.customResource && !mergesListItems(typedPatch, pgr.patchMeta) {
+		return patch
+	}
+	return createJSONPatch("", base, content)
+}
+
+// mergesListItems returns whether a strategic merge patch merges, deletes or orders the items of a list.
+func mergesListItems(patch JSONObject, lookupMeta k8spatch.LookupPatchMeta) bool {
+	for k, v := range patch {
+		if strings.HasPrefix(k, setElementOrderPrefix) || strings.HasPrefix(k, deleteFromPrimitiveListPrefix) {
+			return true
+		}
+		switch typed := v.(type) {
+		case JSONObject:
+			fieldMeta, _, err := lookupMeta.LookupPatchMetadataForStruct(k)
+			if err != nil || mergesListItems(typed, fieldMeta) {
+				return true
+			}
+		case JSONArray:
+			_, patchMeta, err := lookupMeta.LookupPatchMetadataForSlice(k)
+			if err != nil || shouldSubtractList(patchMeta) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// kustomizationPatch adds the identity of the patched resource to a strategic merge patch.
+func kustomizationPatch(base JSONObject, patch JSONObject, name string) JSONObject {
+	result := cloneJSON(patch)
+	result["apiVersion"] = base["apiVersion"]
+	result["kind"] = base["kind"]
+	metadata, ok := result["metadata"].(JSONObject)
+	if !ok {
+		metadata = JSONObject{}
+		result["metadata"] = metadata
+	}
+	metadata["name"] = name
+	return result
+}
+
+func writeKustomization(directoryPath string, kustomization JSONObject) error {
+	kustomization["apiVersion"] = kustomizationAPIVersion
+	kustomization["kind"] = "Kustomization"
+	yamlContent, err := MarshalYAML(kustomization)
+	if err != nil {
+		return err
+	}
+	return WriteFile(yamlContent, path.Join(directoryPath, kustomizationFileName))
+}
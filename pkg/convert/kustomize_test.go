@@ -0,0 +1,259 @@
+package convert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"reflect"
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+	"strings"
+	"testing"
+)
+
+func Test_DumpToKustomization(t *testing.T) {
+	roles := `apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: leader-election
+  namespace: cert-manager
+rules:
+- apiGroups: [coordination.k8s.io]
+  resources: [leases]
+  verbs: [get]
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: leader-election
+  namespace: kube-system
+rules:
+- apiGroups: [coordination.k8s.io]
+  resources: [leases]
+  verbs: [get]
+`
+	documents, err := ReadManifestDocuments(strings.NewReader(roles+"---\n"+widgetCRD), "kustomize.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sc.RegisterCustomResourceDefinitionDocuments(documents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resources := []ManifestDocument{}
+	for _, document := range documents {
+		if !IsCustomResourceDefinition(document.Object) {
+			resources = append(resources, document)
+		}
+	}
+	partitions, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).ExecuteDocuments(context.Background(), resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputDir := t.TempDir()
+	err = DumpToKustomization(partitions, outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, namespace := range []string{"cert-manager", "kube-system"} {
+		var kustomization JSONObject
+		err = readYAMLFile(path.Join(outputDir, "overlays", "rbac.authorization.k8s.io_v1_Role", namespace+"_leader-election", kustomizationFileName), &kustomization)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kustomization["namespace"] != namespace {
+			t.Fatalf("expected the overlay to set namespace '%s': %v", namespace, kustomization)
+		}
+	}
+	for _, partition := range partitions {
+		if partition.GVK().Kind != "Widget" {
+			continue
+		}
+		for _, source := range partition.Sources() {
+			content, err := os.ReadFile(path.Join(outputDir, "overlays", "example.com_v1_Widget", source.Name(), "patch.yaml"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var operations []JSONPatchOperation
+			err = readYAMLFile(path.Join(outputDir, "overlays", "example.com_v1_Widget", source.Name(), "patch.yaml"), &operations)
+			if err != nil || len(operations) == 0 {
+				t.Fatalf("expected RFC 6902 operations, got:\n%s", content)
+			}
+			applied, err := applyJSONPatch(kustomizationResource(partition.Base()), operations)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(applied, source.Original()) {
+				t.Fatalf("operations for '%s' do not reproduce the original: %v", source.Name(), applied)
+			}
+		}
+	}
+}
+
+func Test_KustomizeBuildMajorityBase(t *testing.T) {
+	fileContent, err := os.ReadFile(path.Join("testing", "cert-manager.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	documents, err := ReadManifestDocuments(bytes.NewReader(fileContent), "cert-manager.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	partitions, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{BaseThreshold: 50}).ExecuteDocuments(context.Background(), documents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKustomizeOverlays(t, partitions)
+}
+
+func Test_KustomizeBuildLayers(t *testing.T) {
+	fileContent, err := os.ReadFile(path.Join("testing", "cert-manager.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	documents, err := ReadManifestDocuments(bytes.NewReader(fileContent), "cert-manager.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, options := range []PatchGeneratorOptions{
+		{LayerSimilarity: 0.3},
+		{LayerSimilarity: 0.3, BaseThreshold: 50},
+		{LayerSimilarity: 0.3, PatchFormat: JSON6902PatchFormat},
+	} {
+		partitions, err := NewPatchGeneratorFromSchemaClient(sc, options).ExecuteDocuments(context.Background(), documents)
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers := 0
+		for _, partition := range partitions {
+			layers += len(partition.Layers())
+		}
+		if layers == 0 {
+			t.Fatalf("expected layers with %+v", options)
+		}
+		checkKustomizeOverlays(t, partitions)
+	}
+}
+
+func Test_KustomizeBuildListItems(t *testing.T) {
+	documents, err := ReadManifestDocuments(strings.NewReader(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+      - name: api
+        image: api:1.0
+        ports:
+        - containerPort: 8080
+          name: http
+          protocol: TCP
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: worker
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: api
+        image: api:2.0
+        ports:
+        - containerPort: 8080
+          name: web
+          protocol: TCP
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: api
+spec:
+  ports:
+  - port: 80
+    name: http
+    protocol: TCP
+    targetPort: 8080
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: worker
+spec:
+  ports:
+  - port: 80
+    name: web
+    protocol: TCP
+    targetPort: 8080
+`), "ports.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	partitions, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).ExecuteDocuments(context.Background(), documents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkKustomizeOverlays(t, partitions)
+}
+
+// checkKustomizeOverlays writes the kustomize tree of the partitions and checks that building each overlay
+// reproduces its original.
+func checkKustomizeOverlays(t *testing.T, partitions []PatchPartition) {
+	outputDir := t.TempDir()
+	err := DumpToKustomization(partitions, outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, partition := range partitions {
+		for _, source := range partition.Sources() {
+			built := kustomizeBuild(t, path.Join(outputDir, "overlays", partition.folderName(), source.identity.fileStem()))
+			if len(built) != 1 || !reflect.DeepEqual(built[0], source.Original()) {
+				t.Errorf("overlay of %s '%s' does not reproduce the original: %v", partition.GVK().Kind, source.Name(), built)
+			}
+		}
+	}
+}
+
+// kustomizeBuild runs `kustomize build` on a directory and returns the resources it emits.
+func kustomizeBuild(t *testing.T, directoryPath string) []JSONObject {
+	resMap, err := krusty.MakeKustomizer(krusty.MakeDefaultOptions()).Run(filesys.MakeFsOnDisk(), directoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := []JSONObject{}
+	for _, resource := range resMap.Resources() {
+		content, err := resource.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var object JSONObject
+		err = json.Unmarshal(content, &object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result = append(result, object)
+	}
+	return result
+}
@@ -0,0 +1,284 @@
+package convert
+
+import (
+	"fmt"
+	k8spatch "k8s.io/apimachinery/pkg/util/strategicpatch"
+	"reflect"
+	"sort"
+)
+
+// PatchLayer is an intermediate base shared by a cluster of similar sources within a partition. Its content
+// is the intersection of the sources below it, and it is stored as a patch on top of its parent layer.
+type PatchLayer struct {
+	name       string
+	parent     string
+	base       JSONObject
+	patch      JSONObject
+	operations []JSONPatchOperation
+}
+
+// Name returns the name of the layer, unique within its partition.
+func (pl PatchLayer) Name() string {
+	return pl.name
+}
+
+// Parent returns the name of the parent layer, or an empty string if the layer applies on top of the partition base.
+func (pl PatchLayer) Parent() string {
+	return pl.parent
+}
+
+// Base returns a copy of the full content of the layer.
+func (pl PatchLayer) Base() JSONObject {
+	return cloneJSON(pl.base)
+}
+
+// Patch returns a copy of the strategic merge or JSON merge patch that turns the parent layer into this layer.
+func (pl PatchLayer) Patch() JSONObject {
+	return cloneJSON(pl.patch)
+}
+
+// Operations returns the RFC 6902 operations that turn the parent layer into this layer. They are only
+// computed when the partition format is JSON6902PatchFormat.
+func (pl PatchLayer) Operations() []JSONPatchOperation {
+	return append([]JSONPatchOperation{}, pl.operations...)
+}
+
+// Layers returns the layer tree of the partition, parents before their children. It is empty unless
+// PatchGeneratorOptions.LayerSimilarity is set.
+func (pgr *PatchPartition) Layers() []PatchLayer {
+	return append([]PatchLayer{}, pgr.layers...)
+}
+
+func (pgr *PatchPartition) findLayer(name string) (PatchLayer, bool) {
+	for _, layer := range pgr.layers {
+		if layer.name == name {
+			return layer, true
+		}
+	}
+	return PatchLayer{}, false
+}
+
+// layerBase returns the content a source or layer attached to the named layer is patched onto.
+func (pgr *PatchPartition) layerBase(name string) JSONObject {
+	if layer, ok := pgr.findLayer(name); ok {
+		return layer.base
+	}
+	return pgr.base
+}
+
+// layerPatch returns the patch document emitted for a layer in the partition format.
+func (pgr *PatchPartition) layerPatch(layer PatchLayer) JSONValue {
+	if pgr.format == JSON6902PatchFormat {
+		return append([]JSONPatchOperation{}, layer.operations...)
+	}
+	return layer.patch
+}
+
+// rebuildLayer applies the patches of the named layer and all of its ancestors onto the partition base.
+func (pgr *PatchPartition) rebuildLayer(name string) (JSONObject, error) {
+	layer, ok := pgr.findLayer(name)
+	if !ok {
+		return pgr.base, nil
+	}
+	parent, err := pgr.rebuildLayer(layer.parent)
+	if err != nil {
+		return nil, err
+	}
+	if pgr.format == JSON6902PatchFormat {
+		return applyJSONPatch(parent, layer.operations)
+	}
+	return applyPatch(parent, layer.patch, pgr.patchMeta)
+}
+
+type layerCluster struct {
+	content  JSONObject
+	leaves   int
+	children []*layerCluster
+	source   int
+}
+
+// buildLayers clusters the sources of the partition bottom-up, repeatedly merging the two most similar
+// clusters into their intersection until no pair reaches the similarity threshold. Every merged cluster
+// that shares more than its parent becomes a layer, and every source is attached to its nearest layer. Layers never
+// hold the fields pinned to patches. An intersection has no more leaves than the smaller of its clusters, so pairs
+// whose leaf counts are too far apart to reach the threshold are never intersected.
+func (pgr *PatchPartition) buildLayers(threshold float64, pinnedToPatch []FieldSelector) error {
+	clusters := make([]*layerCluster, 0, len(pgr.sources))
+	for i, source := range pgr.sources {
+		clusters = append(clusters, &layerCluster{
+			content: source.original,
+			leaves:  countLeaves(source.original),
+			source:  i,
+		})
+	}
+	type candidate struct {
+		a, b         *layerCluster
+		intersection JSONObject
+		similarity   float64
+	}
+	candidates := []candidate{}
+	addCandidates := func(c *layerCluster, others []*layerCluster) error {
+		for _, other := range others {
+			shared := other.leaves
+			if c.leaves < shared {
+				shared = c.leaves
+			}
+			if similarity(shared, other.leaves, c.leaves) < threshold {
+				continue
+			}
+			intersection, err := intersectObjects(other.content, c.content, pgr.patchMeta)
+			if err != nil {
+				return err
+			}
+			intersection = removeSelectedFields(intersection, pinnedToPatch, pgr.patchMeta)
+			candidates = append(candidates, candidate{
+				a:            other,
+				b:            c,
+				intersection: intersection,
+				similarity:   similarity(countLeaves(intersection), other.leaves, c.leaves),
+			})
+		}
+		return nil
+	}
+	for i, c := range clusters {
+		err := addCandidates(c, clusters[:i])
+		if err != nil {
+			return err
+		}
+	}
+	for {
+		best := -1
+		for i, c := range candidates {
+			if c.similarity >= threshold && (best < 0 || c.similarity > candidates[best].similarity) {
+				best = i
+			}
+		}
+		if best < 0 {
+			break
+		}
+		merged := &layerCluster{
+			content:  candidates[best].intersection,
+			leaves:   countLeaves(candidates[best].intersection),
+			children: []*layerCluster{candidates[best].a, candidates[best].b},
+			source:   -1,
+		}
+		remaining := []*layerCluster{}
+		for _, c := range clusters {
+			if c != merged.children[0] && c != merged.children[1] {
+				remaining = append(remaining, c)
+			}
+		}
+		remainingCandidates := []candidate{}
+		for _, c := range candidates {
+			if c.a != merged.children[0] && c.a != merged.children[1] && c.b != merged.children[0] && c.b != merged.children[1] {
+				remainingCandidates = append(remainingCandidates, c)
+			}
+		}
+		candidates = remainingCandidates
+		err := addCandidates(merged, remaining)
+		if err != nil {
+			return err
+		}
+		clusters = append(remaining, merged)
+	}
+	pgr.layers = []PatchLayer{}
+	for _, c := range sortClustersBySource(clusters) {
+		err := pgr.assignLayers(c, "", pgr.base)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (pgr *PatchPartition) assignLayers(c *layerCluster, parentName string, parentContent JSONObject) error {
+	if c.source >= 0 {
+		pgr.sources[c.source].layer = parentName
+		return nil
+	}
+	if !reflect.DeepEqual(c.content, parentContent) {
+		layer, err := newPatchLayer(fmt.Sprintf("layer-%d", len(pgr.layers)+1), parentName, parentContent, c.content, pgr.format, pgr.patchMeta)
+		if err != nil {
+			return err
+		}
+		pgr.layers = append(pgr.layers, layer)
+		parentName = layer.name
+		parentContent = layer.base
+	}
+	for _, child := range sortClustersBySource(c.children) {
+		err := pgr.assignLayers(child, parentName, parentContent)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newPatchLayer(name string, parent string, parentContent JSONObject, content JSONObject, format PatchFormat, patchMeta k8spatch.LookupPatchMeta) (PatchLayer, error) {
+	patch, err := calculatePatch(parentContent, content, patchMeta)
+	if err != nil {
+		return PatchLayer{}, err
+	}
+	orderedPatch, err := orderPatch(parentContent, content, patch, patchMeta)
+	if err != nil {
+		return PatchLayer{}, err
+	}
+	layer := PatchLayer{
+		name:   name,
+		parent: parent,
+		base:   content,
+		patch:  orderedPatch,
+	}
+	if format == JSON6902PatchFormat {
+		layer.operations = createJSONPatch("", parentContent, content)
+	}
+	return layer, nil
+}
+
+// sortClustersBySource orders clusters by their first source in input order, so that layer names are stable.
+func sortClustersBySource(clusters []*layerCluster) []*layerCluster {
+	result := append([]*layerCluster{}, clusters...)
+	sort.SliceStable(result, func(i, j int) bool {
+		return firstSource(result[i]) < firstSource(result[j])
+	})
+	return result
+}
+
+func firstSource(c *layerCluster) int {
+	if c.source >= 0 {
+		return c.source
+	}
+	first := -1
+	for _, child := range c.children {
+		if s := firstSource(child); first < 0 || s < first {
+			first = s
+		}
+	}
+	return first
+}
+
+// similarity is the Dice coefficient of two documents, given the number of leaf values they share.
+func similarity(shared int, a int, b int) float64 {
+	if a+b == 0 {
+		return 1
+	}
+	return 2 * float64(shared) / float64(a+b)
+}
+
+func countLeaves(v JSONValue) int {
+	switch typed := v.(type) {
+	case JSONObject:
+		count := 0
+		for _, item := range typed {
+			count += countLeaves(item)
+		}
+		return count
+	case JSONArray:
+		count := 0
+		for _, item := range typed {
+			count += countLeaves(item)
+		}
+		return count
+	}
+	return 1
+}
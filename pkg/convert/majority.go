@@ -0,0 +1,167 @@
+package convert
+
+import (
+	k8spatch "k8s.io/apimachinery/pkg/util/strategicpatch"
+	"math"
+	"reflect"
+)
+
+// majorityBase computes a base holding every field and merged list item that at least the given percentage of the
+// documents agree on. Where documents disagree on a value, the most common one wins if it reaches the threshold.
+func majorityBase(documents []JSONObject, threshold float64, lookupMeta k8spatch.LookupPatchMeta) (JSONObject, error) {
+	required := int(math.Ceil(threshold / 100 * float64(len(documents))))
+	if required < 1 {
+		required = 1
+	}
+	return majorityObject(documents, required, lookupMeta)
+}
+
+func majorityObject(objects []JSONObject, required int, lookupMeta k8spatch.LookupPatchMeta) (JSONObject, error) {
+	keys := []string{}
+	values := map[string][]JSONValue{}
+	for _, object := range objects {
+		for k, v := range object {
+			if _, ok := values[k]; !ok {
+				keys = append(keys, k)
+			}
+			values[k] = append(values[k], v)
+		}
+	}
+	result := JSONObject{}
+	for _, k := range keys {
+		if len(values[k]) < required {
+			continue
+		}
+		value, ok, err := majorityField(k, values[k], required, lookupMeta)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result[k] = value
+		}
+	}
+	return result, nil
+}
+
+func majorityField(key string, values []JSONValue, required int, lookupMeta k8spatch.LookupPatchMeta) (JSONValue, bool, error) {
+	objects := []JSONObject{}
+	arrays := []JSONArray{}
+	for _, value := range values {
+		switch typed := value.(type) {
+		case JSONObject:
+			objects = append(objects, typed)
+		case JSONArray:
+			arrays = append(arrays, typed)
+		}
+	}
+	if len(objects) >= required {
+		fieldMeta, _, err := lookupMeta.LookupPatchMetadataForStruct(key)
+		if err != nil {
+			return nil, false, err
+		}
+		object, err := majorityObject(objects, required, fieldMeta)
+		return object, err == nil, err
+	}
+	if len(arrays) >= required {
+		itemMeta, patchMeta, err := lookupMeta.LookupPatchMetadataForSlice(key)
+		if err != nil {
+			return nil, false, err
+		}
+		if shouldSubtractList(patchMeta) {
+			list, err := majorityList(arrays, required, patchMeta.GetPatchMergeKey(), itemMeta)
+			return list, err == nil, err
+		}
+	}
+	value, ok := majorityValue(values, required)
+	return value, ok, nil
+}
+
+// majorityList votes on the items of merged lists: items are matched by merge key, or by value for lists of
+// primitives, and keep the order in which they first appear.
+func majorityList(arrays []JSONArray, required int, mergeKey string, itemMeta k8spatch.LookupPatchMeta) (JSONArray, error) {
+	result := JSONArray{}
+	if mergeKey == "" {
+		candidates := JSONArray{}
+		for _, array := range arrays {
+			for _, item := range array {
+				if _, ok := findValue(candidates, item); !ok {
+					candidates = append(candidates, item)
+				}
+			}
+		}
+		for _, candidate := range candidates {
+			count := 0
+			for _, array := range arrays {
+				if _, ok := findValue(array, candidate); ok {
+					count++
+				}
+			}
+			if count >= required {
+				result = append(result, candidate)
+			}
+		}
+		return result, nil
+	}
+	mergeValues := JSONArray{}
+	for _, array := range arrays {
+		for _, item := range array {
+			if typedItem, ok := item.(JSONObject); ok {
+				if mergeValue, ok := typedItem[mergeKey]; ok {
+					if _, ok := findValue(mergeValues, mergeValue); !ok {
+						mergeValues = append(mergeValues, mergeValue)
+					}
+				}
+			}
+		}
+	}
+	for _, mergeValue := range mergeValues {
+		items := []JSONObject{}
+		for _, array := range arrays {
+			if item, ok := findListItem(array, mergeKey, mergeValue); ok {
+				items = append(items, item)
+			}
+		}
+		if len(items) < required {
+			continue
+		}
+		item, err := majorityObject(items, required, itemMeta)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// majorityValue returns the most common value, the first one seen on ties, if it reaches the required count.
+func majorityValue(values []JSONValue, required int) (JSONValue, bool) {
+	candidates := JSONArray{}
+	counts := []int{}
+	for _, value := range values {
+		if i, ok := findValue(candidates, value); ok {
+			counts[i]++
+			continue
+		}
+		candidates = append(candidates, value)
+		counts = append(counts, 1)
+	}
+	best := -1
+	for i, count := range counts {
+		if best < 0 || count > counts[best] {
+			best = i
+		}
+	}
+	if best < 0 || counts[best] < required {
+		return nil, false
+	}
+	return candidates[best], true
+}
+
+func findValue(list JSONArray, value JSONValue) (int, bool) {
+	for i, item := range list {
+		if reflect.DeepEqual(item, value) {
+			return i, true
+		}
+	}
+	return -1, false
+}
@@ -0,0 +1,315 @@
+package convert
+
+import (
+	"encoding/json"
+	"fmt"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+type SchemaDefaults string
+
+const (
+	// KeepSchemaDefaults leaves fields set to their schema default as they are
+	KeepSchemaDefaults SchemaDefaults = "keep"
+	// StripSchemaDefaults removes fields set to their schema default
+	StripSchemaDefaults SchemaDefaults = "strip"
+	// ApplySchemaDefaults sets absent fields to their schema default
+	ApplySchemaDefaults SchemaDefaults = "apply"
+)
+
+// FieldPath addresses a field by the keys leading to it from the root of a resource.
+type FieldPath []string
+
+// serverDefault is a default that the API server applies to a field of a builtin kind without declaring it in the
+// OpenAPI schemas. It is given the object holding the field, as some defaults depend on it.
+type serverDefault struct {
+	// since is the first Kubernetes 1.x minor version whose API server applies the default, any version when zero
+	since int
+	value func(object JSONObject) JSONValue
+}
+
+// serverDefaults are the undeclared defaults of builtin kinds, by model and field. Models shared by several kinds,
+// such as PodSpec within the pod templates of every workload, only list defaults that hold for all of them, which
+// leaves out the `restartPolicy` of pods as Jobs require another value.
+var serverDefaults = map[string]map[string]serverDefault{
+	"io.k8s.api.core.v1.Container": {
+		"imagePullPolicy":          {value: imagePullPolicyDefault},
+		"terminationMessagePath":   {value: constantDefault("/dev/termination-log")},
+		"terminationMessagePolicy": {since: 6, value: constantDefault("File")},
+	},
+	"io.k8s.api.core.v1.Probe": {
+		"timeoutSeconds":   {value: constantDefault(1.0)},
+		"periodSeconds":    {value: constantDefault(10.0)},
+		"successThreshold": {value: constantDefault(1.0)},
+		"failureThreshold": {value: constantDefault(3.0)},
+	},
+	"io.k8s.api.core.v1.HTTPGetAction": {
+		"scheme": {value: constantDefault("HTTP")},
+	},
+	"io.k8s.api.core.v1.PodSpec": {
+		"terminationGracePeriodSeconds": {value: constantDefault(30.0)},
+		"dnsPolicy":                     {value: constantDefault("ClusterFirst")},
+		"schedulerName":                 {since: 6, value: constantDefault("default-scheduler")},
+	},
+	"io.k8s.api.core.v1.ServiceSpec": {
+		"type":            {value: constantDefault("ClusterIP")},
+		"sessionAffinity": {value: constantDefault("None")},
+	},
+	"io.k8s.api.apps.v1.DeploymentSpec": {
+		"revisionHistoryLimit":    {since: 9, value: constantDefault(10.0)},
+		"progressDeadlineSeconds": {since: 9, value: constantDefault(600.0)},
+	},
+}
+
+// lookupServerDefaults returns the undeclared defaults of a model that the API server of the Kubernetes version of
+// the schemas applies, and none when that version is unknown.
+func (sc *SchemaClient) lookupServerDefaults(model string) map[string]serverDefault {
+	minor, ok := kubeMinorVersion(sc.kubeVersion)
+	if !ok {
+		return nil
+	}
+	result := map[string]serverDefault{}
+	for name, def := range serverDefaults[model] {
+		if def.since <= minor {
+			result[name] = def
+		}
+	}
+	return result
+}
+
+// kubeMinorVersion returns the minor version of a Kubernetes 1.x version such as "1.27" or "v1.27".
+func kubeMinorVersion(version string) (int, bool) {
+	major, minor, ok := strings.Cut(strings.TrimPrefix(version, "v"), ".")
+	if !ok || major != "1" {
+		return 0, false
+	}
+	result, err := strconv.Atoi(minor)
+	return result, err == nil
+}
+
+func constantDefault(value JSONValue) func(JSONObject) JSONValue {
+	return func(JSONObject) JSONValue {
+		return value
+	}
+}
+
+// imagePullPolicyDefault is Always for images without a tag or with the latest tag, and IfNotPresent otherwise.
+func imagePullPolicyDefault(container JSONObject) JSONValue {
+	image, _ := container["image"].(string)
+	if strings.Contains(image, "@") {
+		return "IfNotPresent"
+	}
+	tag := ""
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		tag = image[i+1:]
+	}
+	if tag == "" || tag == "latest" {
+		return "Always"
+	}
+	return "IfNotPresent"
+}
+
+// DefaultLiveObjectFields are the fields that the API server populates on the objects it returns, and that differ
+// between otherwise identical resources exported from a cluster.
+var DefaultLiveObjectFields = []FieldPath{
+	{"status"},
+	{"metadata", "managedFields"},
+	{"metadata", "resourceVersion"},
+	{"metadata", "uid"},
+	{"metadata", "creationTimestamp"},
+	{"metadata", "generation"},
+	{"metadata", "selfLink"},
+	{"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"},
+}
+
+// ParseFieldPath parses a path of keys such as `.metadata.labels`. Dots within a key are escaped with a backslash,
+// as in `.metadata.annotations.kubectl\.kubernetes\.io/last-applied-configuration`.
+func ParseFieldPath(s string) (FieldPath, error) {
+	if !strings.HasPrefix(s, ".") {
+		return nil, fmt.Errorf("field path '%s' must start with '.'", s)
+	}
+	path := FieldPath{}
+	key := strings.Builder{}
+	escaped := false
+	for _, r := range s[1:] {
+		switch {
+		case escaped:
+			key.WriteRune(r)
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '.':
+			path = append(path, key.String())
+			key.Reset()
+		default:
+			key.WriteRune(r)
+		}
+	}
+	path = append(path, key.String())
+	for _, k := range path {
+		if k == "" {
+			return nil, fmt.Errorf("field path '%s' has an empty key", s)
+		}
+	}
+	return path, nil
+}
+
+func (p FieldPath) String() string {
+	result := ""
+	for _, k := range p {
+		result = appendFieldPath(result, strings.ReplaceAll(k, ".", "\\."))
+	}
+	return result
+}
+
+// CleanLiveObjects returns copies of the documents without the given fields. Objects left empty by the removal of a
+// field, such as `metadata.annotations`, are removed as well.
+func CleanLiveObjects(documents []ManifestDocument, fields []FieldPath) []ManifestDocument {
+	result := make([]ManifestDocument, 0, len(documents))
+	for _, document := range documents {
+		object := cloneJSON(document.Object)
+		for _, field := range fields {
+			removeField(object, field)
+		}
+		document.Object = object
+		result = append(result, document)
+	}
+	return result
+}
+
+// removeField removes the field at path from object, and reports whether that left object empty.
+func removeField(object JSONObject, path FieldPath) bool {
+	if len(path) == 0 {
+		return false
+	}
+	value, ok := object[path[0]]
+	if !ok {
+		return false
+	}
+	if len(path) > 1 {
+		typedValue, ok := value.(JSONObject)
+		if !ok || !removeField(typedValue, path[1:]) {
+			return false
+		}
+	}
+	delete(object, path[0])
+	return len(object) == 0
+}
+
+// normalize removes live object fields and strips or applies schema defaults, as the options ask for.
+func (pg *PatchGenerator) normalize(documents []ManifestDocument) []ManifestDocument {
+	if pg.options.CleanLiveObjects {
+		documents = CleanLiveObjects(documents, append(append([]FieldPath{}, DefaultLiveObjectFields...), pg.options.LiveObjectFields...))
+	}
+	return pg.schemaClient.NormalizeDefaults(documents, pg.options.SchemaDefaults)
+}
+
+// NormalizeDefaults returns copies of the documents with the fields that have a default either stripped, when set to
+// it, or applied, when absent, so that resources which only differ by explicit defaults are equal. Defaults come from
+// the OpenAPI schema of their kind, and for builtin kinds from the defaults the API server applies without declaring
+// them, such as `imagePullPolicy` or the thresholds of probes, when the Kubernetes version of the schemas is known.
+// Only defaults of optional scalar fields are considered: required fields and the merge keys of list items identify
+// what they belong to, and schemas give many of them a zero value default that is never applied. Resources without a
+// schema are left as they are.
+func (sc *SchemaClient) NormalizeDefaults(documents []ManifestDocument, mode SchemaDefaults) []ManifestDocument {
+	if mode != StripSchemaDefaults && mode != ApplySchemaDefaults {
+		return documents
+	}
+	result := make([]ManifestDocument, 0, len(documents))
+	for _, document := range documents {
+		if modelSchema, err := sc.GetSchemaByGVK(document.Object); err == nil {
+			object := cloneJSON(document.Object)
+			sc.normalizeObjectDefaults(object, *modelSchema, mode, "")
+			document.Object = object
+		}
+		result = append(result, document)
+	}
+	return result
+}
+
+func (sc *SchemaClient) normalizeObjectDefaults(object JSONObject, s proto.Schema, mode SchemaDefaults, mergeKey string) {
+	switch typed := resolveSchema(s).(type) {
+	case *proto.Kind:
+		required := map[string]bool{mergeKey: true}
+		for _, name := range typed.RequiredFields {
+			required[name] = true
+		}
+		modelDefaults := sc.lookupServerDefaults(modelName(s))
+		for name, field := range typed.Fields {
+			value, ok := object[name]
+			if ok {
+				sc.normalizeValueDefaults(value, field, mode)
+			}
+			if required[name] {
+				continue
+			}
+			def, hasDefault := scalarDefault(resolveSchema(field))
+			if undeclared, ok := modelDefaults[name]; ok && !hasDefault {
+				def, hasDefault = undeclared.value(object), true
+			}
+			if !hasDefault {
+				continue
+			}
+			if ok && mode == StripSchemaDefaults && reflect.DeepEqual(value, def) {
+				delete(object, name)
+			} else if !ok && mode == ApplySchemaDefaults {
+				object[name] = def
+			}
+		}
+	case *proto.Map:
+		for _, value := range object {
+			sc.normalizeValueDefaults(value, typed.SubType, mode)
+		}
+	}
+}
+
+// normalizeValueDefaults normalizes the objects within value, which never has a default applied or stripped itself.
+func (sc *SchemaClient) normalizeValueDefaults(value JSONValue, s proto.Schema, mode SchemaDefaults) {
+	switch typedValue := value.(type) {
+	case JSONObject:
+		sc.normalizeObjectDefaults(typedValue, s, mode, "")
+	case JSONArray:
+		array, ok := resolveSchema(s).(*proto.Array)
+		if !ok {
+			return
+		}
+		mergeKey, _ := array.GetExtensions()[patchMergeKeyExtensionKey].(string)
+		for _, item := range typedValue {
+			if typedItem, ok := item.(JSONObject); ok {
+				sc.normalizeObjectDefaults(typedItem, array.SubType, mode, mergeKey)
+			}
+		}
+	}
+}
+
+// modelName returns the name of the model that s refers to, if any.
+func modelName(s proto.Schema) string {
+	if ref, ok := s.(proto.Reference); ok {
+		return ref.Reference()
+	}
+	return ""
+}
+
+// scalarDefault returns the default of a primitive schema in the form it takes in decoded resources.
+func scalarDefault(s proto.Schema) (JSONValue, bool) {
+	if _, ok := s.(*proto.Primitive); !ok {
+		return nil, false
+	}
+	def := s.GetDefault()
+	if def == nil {
+		return nil, false
+	}
+	content, err := json.Marshal(def)
+	if err != nil {
+		return nil, false
+	}
+	var result JSONValue
+	err = json.Unmarshal(content, &result)
+	if err != nil {
+		return nil, false
+	}
+	return result, true
+}
@@ -0,0 +1,246 @@
+package convert
+
+import (
+	"context"
+	"github.com/amannm/configism/internal/schemas"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ParseFieldPath(t *testing.T) {
+	path, err := ParseFieldPath(`.metadata.annotations.kubectl\.kubernetes\.io/last-applied-configuration`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(path, FieldPath{"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration"}) {
+		t.Fatalf("unexpected field path: %v", path)
+	}
+	if path.String() != `.metadata.annotations.kubectl\.kubernetes\.io/last-applied-configuration` {
+		t.Fatalf("unexpected field path string: %s", path.String())
+	}
+	for _, invalid := range []string{"", "metadata", ".metadata..name", ".metadata."} {
+		if _, err := ParseFieldPath(invalid); err == nil {
+			t.Fatalf("expected an error for '%s'", invalid)
+		}
+	}
+}
+
+func Test_CleanLiveObjects(t *testing.T) {
+	manifests := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+  uid: 0b6f1c9e-1f0e-4a53-9d1b-6d0a8f7a0c11
+  resourceVersion: "1234"
+  creationTimestamp: "2024-01-01T00:00:00Z"
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: '{}'
+  managedFields:
+  - manager: kubectl
+data:
+  key: value
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+  uid: 4b0b7e0e-3a7c-4d3b-8c4e-2f1d2e3c4b5a
+  resourceVersion: "5678"
+  annotations:
+    kubectl.kubernetes.io/last-applied-configuration: '{}'
+    team: platform
+  labels:
+    revision: "7"
+data:
+  key: value
+`
+	documents, err := ReadManifestDocuments(strings.NewReader(manifests), "live.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleaned := CleanLiveObjects(documents, append(DefaultLiveObjectFields, FieldPath{"metadata", "labels", "revision"}))
+	expected := []JSONObject{
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": JSONObject{"name": "first"}, "data": JSONObject{"key": "value"}},
+		{"apiVersion": "v1", "kind": "ConfigMap", "metadata": JSONObject{"name": "second", "annotations": JSONObject{"team": "platform"}}, "data": JSONObject{"key": "value"}},
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(cleaned[i].Object, expected[i]) {
+			t.Fatalf("unexpected cleaned resource: %v", cleaned[i].Object)
+		}
+		if cleaned[i].Position != documents[i].Position {
+			t.Fatalf("expected the position of the document to be kept")
+		}
+	}
+	if _, ok := documents[0].Object["metadata"].(JSONObject)["uid"]; !ok {
+		t.Fatal("expected the input documents to be left untouched")
+	}
+
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	partitions, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{CleanLiveObjects: true}).ExecuteDocuments(context.Background(), documents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patches := []JSONObject{}
+	for _, source := range partitions[0].sources {
+		patches = append(patches, source.Patch())
+	}
+	expectedPatches := []JSONObject{
+		{"metadata": JSONObject{"name": "first"}},
+		{"metadata": JSONObject{"name": "second", "annotations": JSONObject{"team": "platform"}, "labels": JSONObject{"revision": "7"}}},
+	}
+	if !reflect.DeepEqual(patches, expectedPatches) {
+		t.Fatalf("unexpected patches: %v", patches)
+	}
+}
+
+func Test_NormalizeDefaults(t *testing.T) {
+	manifests := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: explicit
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:1.0
+        imagePullPolicy: IfNotPresent
+        ports:
+        - containerPort: 8080
+          protocol: TCP
+        readinessProbe:
+          httpGet:
+            port: 8080
+          successThreshold: 1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: implicit
+spec:
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:1.0
+        ports:
+        - containerPort: 8080
+        readinessProbe:
+          httpGet:
+            port: 8080
+`
+	documents, err := ReadManifestDocuments(strings.NewReader(manifests), "defaults.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bundle, err := schemas.KubeSchemas("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncached, err := NewSchemaClientFromFS(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	unversioned := uncached.NormalizeDefaults(documents, ApplySchemaDefaults)
+	if _, ok := unversioned[1].Object["spec"].(JSONObject)["template"].(JSONObject)["spec"].(JSONObject)["containers"].(JSONArray)[0].(JSONObject)["imagePullPolicy"]; ok {
+		t.Fatal("expected no server defaults without a Kubernetes version")
+	}
+	uncached.SetKubeVersion(schemas.DefaultKubeVersion)
+	cacheDir := t.TempDir()
+	for _, test := range []struct {
+		mode             SchemaDefaults
+		expected         JSONObject
+		pullPolicy       JSONValue
+		successThreshold JSONValue
+	}{
+		{StripSchemaDefaults, JSONObject{"containerPort": 8080.0}, nil, nil},
+		{ApplySchemaDefaults, JSONObject{"containerPort": 8080.0, "protocol": "TCP"}, "IfNotPresent", 1.0},
+	} {
+		for i := 0; i < 3; i++ {
+			sc := uncached
+			if i > 0 {
+				sc, err = NewCachedSchemaClientFromFS(bundle, cacheDir)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sc.SetKubeVersion(schemas.DefaultKubeVersion)
+			}
+			normalized := sc.NormalizeDefaults(documents, test.mode)
+			for _, document := range normalized {
+				containers := document.Object["spec"].(JSONObject)["template"].(JSONObject)["spec"].(JSONObject)["containers"].(JSONArray)
+				container := containers[0].(JSONObject)
+				if container["name"] != "web" || !reflect.DeepEqual(container["ports"], JSONArray{test.expected}) {
+					t.Fatalf("unexpected container with %s defaults: %v", test.mode, container)
+				}
+				if container["imagePullPolicy"] != test.pullPolicy || container["readinessProbe"].(JSONObject)["successThreshold"] != test.successThreshold {
+					t.Fatalf("unexpected server defaults with %s defaults: %v", test.mode, container)
+				}
+			}
+			partitions, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{SchemaDefaults: test.mode}).ExecuteDocuments(context.Background(), documents)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, source := range partitions[0].sources {
+				if !reflect.DeepEqual(source.Patch(), JSONObject{"metadata": JSONObject{"name": source.identity.Name}}) {
+					t.Fatalf("unexpected patch with %s defaults: %v", test.mode, source.Patch())
+				}
+			}
+		}
+	}
+	if kept := uncached.NormalizeDefaults(documents, KeepSchemaDefaults); !reflect.DeepEqual(kept, documents) {
+		t.Fatal("expected documents to be kept as they are")
+	}
+	jobs, err := ReadManifestDocuments(strings.NewReader(`apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+spec:
+  template:
+    spec:
+      containers:
+      - name: migrate
+        image: migrate:1.0
+      restartPolicy: Never
+---
+apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: cleanup
+spec:
+  schedule: "0 * * * *"
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: cleanup
+            image: cleanup:1.0
+`), "jobs.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied := uncached.NormalizeDefaults(jobs, ApplySchemaDefaults)
+	jobPod := applied[0].Object["spec"].(JSONObject)["template"].(JSONObject)["spec"].(JSONObject)
+	cronJobPod := applied[1].Object["spec"].(JSONObject)["jobTemplate"].(JSONObject)["spec"].(JSONObject)["template"].(JSONObject)["spec"].(JSONObject)
+	if jobPod["restartPolicy"] != "Never" || jobPod["dnsPolicy"] != "ClusterFirst" {
+		t.Fatalf("unexpected Job pod template: %v", jobPod)
+	}
+	if _, ok := cronJobPod["restartPolicy"]; ok || cronJobPod["terminationGracePeriodSeconds"] != 30.0 {
+		t.Fatalf("unexpected CronJob pod template: %v", cronJobPod)
+	}
+	for version, expected := range map[string]int{"1.8": 0, "v1.27": 2, "": 0} {
+		versioned := &SchemaClient{kubeVersion: version}
+		if deploymentDefaults := versioned.lookupServerDefaults("io.k8s.api.apps.v1.DeploymentSpec"); len(deploymentDefaults) != expected {
+			t.Fatalf("expected %d Deployment server defaults for version '%s', got %v", expected, version, deploymentDefaults)
+		}
+	}
+	for image, expected := range map[string]string{"web": "Always", "web:latest": "Always", "registry:5000/web": "Always", "registry:5000/web:1.0": "IfNotPresent", "web@sha256:abc": "IfNotPresent"} {
+		if policy := imagePullPolicyDefault(JSONObject{"image": image}); policy != expected {
+			t.Fatalf("expected pull policy '%s' for image '%s', got '%s'", expected, image, policy)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package convert
 
 import (
+	k8spatch "k8s.io/apimachinery/pkg/util/strategicpatch"
 	"reflect"
 	"strings"
 )
@@ -25,59 +26,114 @@ func testKeyValueMatch(query JSONObject, target JSONObject) bool {
 
 const setElementOrderPrefix = "$setElementOrder/"
 
+// ExecutePatchOrdering orders the items of every list in a strategic merge patch as its `$setElementOrder` directives
+// ask for, and drops the directives. The patch no longer reorders the items that it leaves out, so orderPatch should
+// be preferred where the content the patch applies to is known.
 func ExecutePatchOrdering(o JSONObject) (JSONObject, error) {
-	ordering := map[string][]JSONObject{}
+	return orderPatchItems(o, "", func(string) bool { return false })
+}
+
+// orderPatch orders the items of the lists in a patch from content to other, and drops the `$setElementOrder`
+// directives that applying the patch onto content does not need to reproduce other. Directives remain for the lists
+// whose order differs from content.
+func orderPatch(content JSONObject, other JSONObject, patch JSONObject, lookupMeta k8spatch.LookupPatchMeta) (JSONObject, error) {
+	kept := map[string]bool{}
+	directives := []string{}
+	_, err := orderPatchItems(patch, "", func(path string) bool {
+		kept[path] = true
+		directives = append(directives, path)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	keep := func(path string) bool {
+		return kept[path]
+	}
+	for _, directive := range directives {
+		kept[directive] = false
+		ordered, err := orderPatchItems(patch, "", keep)
+		if err != nil {
+			return nil, err
+		}
+		applied, err := applyPatch(content, ordered, lookupMeta)
+		if err != nil || !reflect.DeepEqual(applied, other) {
+			kept[directive] = true
+		}
+	}
+	return orderPatchItems(patch, "", keep)
+}
+
+// orderPatchItems orders the items of the lists in o by their `$setElementOrder` directives, keeping the directives
+// of the lists for which keep returns true, given the path of the list.
+func orderPatchItems(o JSONObject, path string, keep func(path string) bool) (JSONObject, error) {
+	ordering := map[string]JSONArray{}
+	for k, v := range o {
+		if strings.HasPrefix(k, setElementOrderPrefix) {
+			if orderList, ok := v.(JSONArray); ok {
+				ordering[strings.TrimPrefix(k, setElementOrderPrefix)] = orderList
+			}
+		}
+	}
 	result := JSONObject{}
 	for k, v := range o {
+		if strings.HasPrefix(k, setElementOrderPrefix) {
+			if keep(appendFieldPath(path, strings.TrimPrefix(k, setElementOrderPrefix))) {
+				result[k] = v
+			}
+			continue
+		}
 		switch typedValue := v.(type) {
 		case JSONObject:
-			reorderedValue, err := ExecutePatchOrdering(typedValue)
+			reorderedValue, err := orderPatchItems(typedValue, appendFieldPath(path, k), keep)
 			if err != nil {
 				return nil, err
 			}
 			result[k] = reorderedValue
 		case JSONArray:
-			if strings.HasPrefix(k, setElementOrderPrefix) {
-				nameOrdering := []JSONObject{}
-				if nameList, ok := v.(JSONArray); ok {
-					for _, item := range nameList {
-						if typedItem, ok := item.(JSONObject); ok {
-							nameOrdering = append(nameOrdering, typedItem)
-						}
-					}
-				}
-				targetKey := strings.TrimPrefix(k, setElementOrderPrefix)
-				ordering[targetKey] = nameOrdering
-			} else {
-				if nameOrdering, ok := ordering[k]; ok {
-					reordered := []JSONObject{}
-					for _, nameOrder := range nameOrdering {
-						for _, valueToOrder := range typedValue {
-							if typedValueToOrder, ok := valueToOrder.(JSONObject); ok {
-								if testKeyValueMatch(nameOrder, typedValueToOrder) {
-									reordered = append(reordered, typedValueToOrder)
-								}
-							}
-						}
+			items := JSONArray{}
+			for i, valueItem := range typedValue {
+				if typedValueItem, ok := valueItem.(JSONObject); ok {
+					reorderedValueItem, err := orderPatchItems(typedValueItem, appendIndexPath(appendFieldPath(path, k), i), keep)
+					if err != nil {
+						return nil, err
 					}
-					result[k] = reordered
+					items = append(items, reorderedValueItem)
 				} else {
-					for _, valueItem := range typedValue {
-						if typedValueItem, ok := valueItem.(JSONObject); ok {
-							reorderedValueItem, err := ExecutePatchOrdering(typedValueItem)
-							if err != nil {
-								return nil, err
-							}
-							result[k] = reorderedValueItem
-						} else {
-							result[k] = valueItem
-						}
-					}
+					items = append(items, valueItem)
 				}
 			}
+			if orderList, ok := ordering[k]; ok {
+				items = orderListItems(items, orderList)
+			}
+			result[k] = items
 		default:
 			result[k] = v
 		}
 	}
 	return result, nil
 }
+
+func orderListItems(items JSONArray, orderList JSONArray) JSONArray {
+	reordered := JSONArray{}
+	used := make([]bool, len(items))
+	for _, order := range orderList {
+		for i, item := range items {
+			if used[i] {
+				continue
+			}
+			typedOrder, isObjectOrder := order.(JSONObject)
+			typedItem, isObjectItem := item.(JSONObject)
+			if (isObjectOrder && isObjectItem && testKeyValueMatch(typedOrder, typedItem)) || (!isObjectOrder && reflect.DeepEqual(order, item)) {
+				reordered = append(reordered, item)
+				used[i] = true
+			}
+		}
+	}
+	for i, item := range items {
+		if !used[i] {
+			reordered = append(reordered, item)
+		}
+	}
+	return reordered
+}
@@ -1,6 +1,7 @@
 package convert
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"k8s.io/apimachinery/pkg/runtime/schema"
@@ -9,7 +10,8 @@ import (
 	"os"
 	"path"
 	"reflect"
-	"sigs.k8s.io/yaml"
+	"sort"
+	"strings"
 )
 
 type JSONObject = map[string]any
@@ -18,19 +20,100 @@ type JSONValue = any
 
 type PatchGenerator struct {
 	schemaClient *SchemaClient
+	options      PatchGeneratorOptions
 }
 
+type PatchGeneratorOptions struct {
+	// FallbackToMergePatch decomposes kinds without a known schema with JSON merge patch (RFC 7386)
+	// semantics instead of failing the whole run.
+	FallbackToMergePatch bool
+	// PatchFormat selects the format of the emitted patches, MergePatchFormat by default.
+	PatchFormat PatchFormat
+	// PartitionOrder selects the order of the returned partitions, GVKPartitionOrder by default.
+	// Sources within a partition always keep their input order.
+	PartitionOrder PartitionOrder
+	// PartitionByNamespace partitions resources by namespace in addition to group, version and kind.
+	PartitionByNamespace bool
+	// LayerSimilarity, when positive, clusters the sources of each partition into a tree of layers, repeatedly
+	// merging the two most similar clusters while their similarity, between 0 and 1, is at least this value.
+	LayerSimilarity float64
+	// BaseThreshold is the percentage of sources that must agree on a field or merged list item for it to be part
+	// of the partition base. Zero or 100 keeps only what every source shares.
+	BaseThreshold float64
+	// Workers is the number of partitions and patches computed concurrently, runtime.GOMAXPROCS by default.
+	Workers int
+	// ReportAllErrors keeps going past resources and partitions that fail, returning every failure as an ErrorList
+	// instead of only the first one.
+	ReportAllErrors bool
+	// CleanLiveObjects removes the fields that the API server populates, DefaultLiveObjectFields along with
+	// LiveObjectFields, from every resource before decomposing it.
+	CleanLiveObjects bool
+	// LiveObjectFields are removed in addition to DefaultLiveObjectFields when CleanLiveObjects is set.
+	LiveObjectFields []FieldPath
+	// SchemaDefaults strips or applies the defaults of the OpenAPI schemas before decomposing, so that resources which
+	// only differ by explicit defaults share a base. KeepSchemaDefaults by default.
+	SchemaDefaults SchemaDefaults
+	// FieldRules pin the fields they select to the patches or to the base, or ignore them, for the kinds they apply to.
+	FieldRules []FieldRule
+}
+
+type PartitionOrder string
+
+const (
+	// GVKPartitionOrder sorts partitions by group, version and kind
+	GVKPartitionOrder PartitionOrder = "gvk"
+	// AppearancePartitionOrder keeps partitions in the order their first resource appears in the input
+	AppearancePartitionOrder PartitionOrder = "appearance"
+)
+
+type PatchStrategy string
+
+const (
+	StrategicMergePatchStrategy PatchStrategy = "strategic-merge"
+	JSONMergePatchStrategy      PatchStrategy = "json-merge"
+)
+
+// jsonMergePatchMeta carries no patch strategies at all, which makes strategic merge patches
+// degrade to plain JSON merge patches.
+var jsonMergePatchMeta = newSchemaPatchMeta(nil)
+
 func (pgr *PatchPartition) String() string {
-	jsonContent, _ := json.Marshal(pgr.base)
-	yamlContent, _ := yaml.JSONToYAML(jsonContent)
+	yamlContent, _ := pgr.marshalYAML(pgr.base)
 	return fmt.Sprintf("gvk = %s\n\n%s", pgr.gvk, yamlContent)
 }
 
 func (pgr *PatchPartition) DumpToFolder(directoryPath string) error {
-	rootDir := path.Join(directoryPath, fmt.Sprintf("%s_%s_%s", pgr.gvk.Group, pgr.gvk.Version, pgr.gvk.Kind))
-	jsonContent, _ := json.Marshal(pgr.base)
-	yamlContent, _ := yaml.JSONToYAML(jsonContent)
-	err := os.Mkdir(rootDir, 0755)
+	rootDir := path.Join(directoryPath, pgr.folderName())
+	err := pgr.dumpBaseToFolder(rootDir)
+	if err != nil {
+		return err
+	}
+	// every source is written, even with an empty patch, so that ComposeFolder can rebuild all of them
+	for _, source := range pgr.sources {
+		fileName := fmt.Sprintf("%s.yaml", source.identity.fileStem())
+		if fileName == partitionFileName {
+			return fmt.Errorf("%s %s cannot be written to the folder layout, as its patch file would replace the partition file '%s'", pgr.gvk.Kind, source.describe(), partitionFileName)
+		}
+		patch, _ := pgr.sourcePatch(source)
+		yamlContent, err := pgr.marshalYAML(patch)
+		if err != nil {
+			return err
+		}
+		err = WriteFile(append(source.provenance.header(), yamlContent...), path.Join(rootDir, fileName))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dumpBaseToFolder writes the base, the partition description and the layers of the partition into rootDir.
+func (pgr *PatchPartition) dumpBaseToFolder(rootDir string) error {
+	yamlContent, err := pgr.marshalYAML(pgr.base)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(rootDir, 0755)
 	if err != nil {
 		return err
 	}
@@ -38,17 +121,75 @@ func (pgr *PatchPartition) DumpToFolder(directoryPath string) error {
 	if err != nil {
 		return err
 	}
+	partitionYAML, err := MarshalYAML(pgr.describe())
+	if err != nil {
+		return err
+	}
+	err = WriteFile(partitionYAML, path.Join(rootDir, partitionFileName))
+	if err != nil {
+		return err
+	}
+	if len(pgr.layers) > 0 {
+		err = os.MkdirAll(path.Join(rootDir, layersFolderName), 0755)
+		if err != nil {
+			return err
+		}
+	}
+	for _, layer := range pgr.layers {
+		yamlContent, err := pgr.marshalYAML(pgr.layerPatch(layer))
+		if err != nil {
+			return err
+		}
+		err = WriteFile(yamlContent, path.Join(rootDir, layersFolderName, fmt.Sprintf("%s.yaml", layer.name)))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partitionFileName describes the partition. Names of most kinds cannot start with '_', but path segment names, such as
+// those of RBAC roles, can, so DumpToFolder refuses a source whose patch file would take its place.
+const partitionFileName = "_partition.yaml"
+
+// layersFolderName holds one patch per layer, each applying on top of its parent layer
+const layersFolderName = "_layers"
+
+func (pgr *PatchPartition) describe() JSONObject {
+	sources := make([]string, 0, len(pgr.sources))
 	for _, source := range pgr.sources {
-		if len(source.patch) > 0 {
-			jsonContent, _ := json.Marshal(source.patch)
-			yamlContent, _ := yaml.JSONToYAML(jsonContent)
-			err = WriteFile(yamlContent, path.Join(rootDir, fmt.Sprintf("%s.yaml", source.name)))
-			if err != nil {
-				return err
+		sources = append(sources, source.identity.fileStem())
+	}
+	description := JSONObject{
+		"group":     pgr.gvk.Group,
+		"version":   pgr.gvk.Version,
+		"kind":      pgr.gvk.Kind,
+		"namespace": pgr.namespace,
+		"strategy":  pgr.strategy,
+		"format":    pgr.format,
+		"sources":   sources,
+	}
+	if len(pgr.layers) > 0 {
+		layers := JSONArray{}
+		for _, layer := range pgr.layers {
+			layerSources := JSONArray{}
+			for _, source := range pgr.sources {
+				if source.layer == layer.name {
+					layerSources = append(layerSources, source.identity.fileStem())
+				}
 			}
+			layers = append(layers, JSONObject{"name": layer.name, "parent": layer.parent, "sources": layerSources})
 		}
+		description["layers"] = layers
 	}
-	return nil
+	return description
+}
+
+func (pgr *PatchPartition) folderName() string {
+	if pgr.namespace != "" {
+		return fmt.Sprintf("%s_%s_%s_%s", pgr.gvk.Group, pgr.gvk.Version, pgr.gvk.Kind, pgr.namespace)
+	}
+	return fmt.Sprintf("%s_%s_%s", pgr.gvk.Group, pgr.gvk.Version, pgr.gvk.Kind)
 }
 
 func NewPatchGenerator(schemaFolderPath string) (*PatchGenerator, error) {
@@ -56,29 +197,34 @@ func NewPatchGenerator(schemaFolderPath string) (*PatchGenerator, error) {
 	if err != nil {
 		return nil, err
 	}
-	c := &PatchGenerator{
+	return NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}), nil
+}
+
+func NewPatchGeneratorFromSchemaClient(sc *SchemaClient, options PatchGeneratorOptions) *PatchGenerator {
+	if options.PatchFormat == "" {
+		options.PatchFormat = MergePatchFormat
+	}
+	if options.PartitionOrder == "" {
+		options.PartitionOrder = GVKPartitionOrder
+	}
+	if options.SchemaDefaults == "" {
+		options.SchemaDefaults = KeepSchemaDefaults
+	}
+	return &PatchGenerator{
 		sc,
+		options,
 	}
-	return c, nil
 }
 
 func (pgr *PatchPartition) GetBaseYAML() ([]byte, error) {
-	baseBytes, err := json.MarshalIndent(pgr.base, "", "    ")
-	if err != nil {
-		return nil, err
-	}
-	return yaml.JSONToYAML(baseBytes)
+	return pgr.marshalYAML(pgr.base)
 }
 
 func (pgr *PatchPartition) GetPatchYAMLs() ([][]byte, error) {
 	result := [][]byte{}
 	for _, source := range pgr.sources {
-		if len(source.patch) > 0 {
-			jsonBytes, err := json.MarshalIndent(source.patch, "", "    ")
-			if err != nil {
-				return nil, err
-			}
-			yamlBytes, err := yaml.JSONToYAML(jsonBytes)
+		if patch, ok := pgr.sourcePatch(source); ok {
+			yamlBytes, err := pgr.marshalYAML(patch)
 			if err != nil {
 				return nil, err
 			}
@@ -91,11 +237,7 @@ func (pgr *PatchPartition) GetPatchYAMLs() ([][]byte, error) {
 func (pgr *PatchPartition) GetOriginalYAMLs() ([][]byte, error) {
 	result := [][]byte{}
 	for _, source := range pgr.sources {
-		jsonBytes, err := json.MarshalIndent(source.original, "", "    ")
-		if err != nil {
-			return nil, err
-		}
-		yamlBytes, err := yaml.JSONToYAML(jsonBytes)
+		yamlBytes, err := pgr.marshalYAML(source.original)
 		if err != nil {
 			return nil, err
 		}
@@ -104,89 +246,390 @@ func (pgr *PatchPartition) GetOriginalYAMLs() ([][]byte, error) {
 	return result, nil
 }
 
+// PatchSource is a single resource of a partition, along with the patch that reproduces it from the partition base.
 type PatchSource struct {
-	name     string
-	original JSONObject
-	patch    JSONObject
+	identity   ResourceIdentity
+	provenance Provenance
+	layer      string
+	original   JSONObject
+	patch      JSONObject
+	operations []JSONPatchOperation
 }
+
+// Identity returns the group, kind, namespace and name that identify the resource.
+func (ps PatchSource) Identity() ResourceIdentity {
+	return ps.identity
+}
+
+// Name returns the metadata.name of the resource.
+func (ps PatchSource) Name() string {
+	return ps.identity.Name
+}
+
+// Namespace returns the metadata.namespace of the resource, or an empty string if it has none.
+func (ps PatchSource) Namespace() string {
+	return ps.identity.Namespace
+}
+
+// Position returns where the resource was read from, which is unknown for resources given to PatchGenerator.Execute.
+func (ps PatchSource) Position() SourcePosition {
+	return ps.provenance.Position
+}
+
+// Provenance returns where the resource was read from, including the comments that preceded it.
+func (ps PatchSource) Provenance() Provenance {
+	return ps.provenance
+}
+
+// describe returns the qualified name of the resource, followed by its position if it is known.
+func (ps PatchSource) describe() string {
+	if ps.provenance.Position.Line > 0 {
+		return fmt.Sprintf("'%s' at %s", ps.identity.QualifiedName(), ps.provenance.Position)
+	}
+	return fmt.Sprintf("'%s'", ps.identity.QualifiedName())
+}
+
+// Layer returns the name of the layer the patch applies on top of, or an empty string for the partition base.
+func (ps PatchSource) Layer() string {
+	return ps.layer
+}
+
+// Original returns a copy of the resource as it was given to PatchGenerator.Execute.
+func (ps PatchSource) Original() JSONObject {
+	return cloneJSON(ps.original)
+}
+
+// Patch returns a copy of the strategic merge or JSON merge patch that turns the partition base
+// into the original resource.
+func (ps PatchSource) Patch() JSONObject {
+	return cloneJSON(ps.patch)
+}
+
+// Operations returns the RFC 6902 operations that turn the partition base into the original
+// resource. They are only computed when the partition format is JSON6902PatchFormat.
+func (ps PatchSource) Operations() []JSONPatchOperation {
+	return append([]JSONPatchOperation{}, ps.operations...)
+}
+
+// PatchPartition groups resources of the same kind into the content they all share and a patch per resource.
 type PatchPartition struct {
-	gvk     schema.GroupVersionKind
-	base    JSONObject
-	sources []PatchSource
+	gvk       schema.GroupVersionKind
+	namespace string
+	base      JSONObject
+	sources   []PatchSource
+	layers    []PatchLayer
+	order     *keyOrder
+	strategy  PatchStrategy
+	format    PatchFormat
+	patchMeta k8spatch.LookupPatchMeta
+	// customResource is set when the patch metadata comes from a CustomResourceDefinition
+	customResource bool
 }
 
-func (pg *PatchGenerator) Execute(resources []JSONObject) ([]PatchPartition, error) {
-	partitions := map[schema.GroupVersionKind]PatchPartition{}
+// GVK returns the group, version and kind shared by every resource in the partition.
+func (pgr *PatchPartition) GVK() schema.GroupVersionKind {
+	return pgr.gvk
+}
+
+// Namespace returns the namespace shared by every resource in the partition when partitioning by
+// namespace, or an empty string otherwise.
+func (pgr *PatchPartition) Namespace() string {
+	return pgr.namespace
+}
+
+// Base returns a copy of the content shared by every resource in the partition.
+func (pgr *PatchPartition) Base() JSONObject {
+	return cloneJSON(pgr.base)
+}
+
+// Sources returns the partitioned resources in input order.
+func (pgr *PatchPartition) Sources() []PatchSource {
+	return append([]PatchSource{}, pgr.sources...)
+}
+
+// SourceNames returns the names of the partitioned resources in input order, prefixed by their namespace if they have one.
+func (pgr *PatchPartition) SourceNames() []string {
+	names := make([]string, 0, len(pgr.sources))
+	for _, source := range pgr.sources {
+		names = append(names, source.identity.QualifiedName())
+	}
+	return names
+}
+
+// Strategy returns the patch semantics used to compute the base and the patches of the partition.
+func (pgr *PatchPartition) Strategy() PatchStrategy {
+	return pgr.strategy
+}
+
+// Format returns the format of the patch documents emitted for the partition.
+func (pgr *PatchPartition) Format() PatchFormat {
+	return pgr.format
+}
+
+// marshalYAML encodes a document of the partition as YAML, keeping keys in the order they appear in its sources.
+func (pgr *PatchPartition) marshalYAML(v any) ([]byte, error) {
+	return marshalOrderedYAML(v, pgr.order, pgr.patchMeta)
+}
+
+// sourcePatch returns the patch document emitted for a source in the partition format, and whether it changes anything.
+func (pgr *PatchPartition) sourcePatch(source PatchSource) (JSONValue, bool) {
+	if pgr.format == JSON6902PatchFormat {
+		return append([]JSONPatchOperation{}, source.operations...), len(source.operations) > 0
+	}
+	return source.patch, len(source.patch) > 0
+}
+
+func (pgr *PatchPartition) applySourcePatch(source PatchSource) (JSONObject, error) {
+	base, err := pgr.rebuildLayer(source.layer)
+	if err != nil {
+		return nil, err
+	}
+	if pgr.format == JSON6902PatchFormat {
+		return applyJSONPatch(base, source.operations)
+	}
+	return applyPatch(base, source.patch, pgr.patchMeta)
+}
+
+// Execute decomposes resources into partitions, computing partitions and the patches within them concurrently.
+// The result does not depend on the number of workers. It returns ctx.Err() if ctx is done before it completes.
+func (pg *PatchGenerator) Execute(ctx context.Context, resources []JSONObject) ([]PatchPartition, error) {
+	documents := make([]ManifestDocument, 0, len(resources))
 	for _, resource := range resources {
+		documents = append(documents, ManifestDocument{Object: resource})
+	}
+	return pg.ExecuteDocuments(ctx, documents)
+}
+
+// ExecuteDocuments decomposes resources like Execute, reporting errors at the position each resource was read from.
+func (pg *PatchGenerator) ExecuteDocuments(ctx context.Context, documents []ManifestDocument) ([]PatchPartition, error) {
+	documents = pg.normalize(documents)
+	partitions, errs := partitionResources(documents, pg.options.PartitionByNamespace)
+	if len(errs) > 0 && !pg.options.ReportAllErrors {
+		return nil, errs[0]
+	}
+	pool := newWorkerPool(pg.options.Workers)
+	partitionErrs := pool.forEach(ctx, len(partitions), func(i int) error {
+		return pg.decomposePartition(ctx, pool, &partitions[i])
+	})
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	decomposed := make([]PatchPartition, 0, len(partitions))
+	for i := range partitions {
+		err := partitionErrs[i]
+		if err != nil {
+			sourceErrs := flattenErrors(err)
+			if !pg.options.ReportAllErrors {
+				return nil, sourceErrs[0]
+			}
+			errs = append(errs, sourceErrs...)
+			continue
+		}
+		decomposed = append(decomposed, partitions[i])
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	partitions = decomposed
+	if pg.options.PartitionOrder == GVKPartitionOrder {
+		sort.SliceStable(partitions, func(i, j int) bool {
+			if partitions[i].gvk != partitions[j].gvk {
+				return compareGVK(partitions[i].gvk, partitions[j].gvk) < 0
+			}
+			return partitions[i].namespace < partitions[j].namespace
+		})
+	}
+	return partitions, nil
+}
+
+type partitionKey struct {
+	gvk       schema.GroupVersionKind
+	namespace string
+}
+
+// partitionResources groups resources by GVK, and optionally namespace, keeping partitions in order
+// of first appearance and sources in input order. Resources that cannot be identified are left out and
+// reported in the returned list.
+func partitionResources(documents []ManifestDocument, byNamespace bool) ([]PatchPartition, ErrorList) {
+	partitions := []PatchPartition{}
+	partitionIndex := map[partitionKey]int{}
+	identities := map[ResourceIdentity]string{}
+	errs := ErrorList{}
+	for i, document := range documents {
+		resource := document.Object
+		location := describeLocation(i, document.Position)
 		gvk, err := ComputeGVK(resource)
 		if err != nil {
-			return nil, err
+			errs = append(errs, fmt.Errorf("%s: %w", location, err))
+			continue
 		}
-		name, err := GetResourceName(resource)
+		identity, err := GetResourceIdentity(resource)
 		if err != nil {
-			return nil, err
+			errs = append(errs, fmt.Errorf("%s (%s): %w", location, gvk.String(), err))
+			continue
 		}
-		partition, ok := partitions[*gvk]
-		if ok {
-			next := append(partition.sources, PatchSource{
-				name:     name,
-				original: resource,
-				patch:    JSONObject{},
+		if previous, ok := identities[identity]; ok {
+			errs = append(errs, fmt.Errorf("%s (%s): duplicates %s", location, identity.String(), previous))
+			continue
+		}
+		identities[identity] = location
+		key := partitionKey{gvk: *gvk}
+		if byNamespace {
+			key.namespace = identity.Namespace
+		}
+		index, ok := partitionIndex[key]
+		if !ok {
+			index = len(partitions)
+			partitionIndex[key] = index
+			partitions = append(partitions, PatchPartition{
+				gvk:       key.gvk,
+				namespace: key.namespace,
+				base:      JSONObject{},
+				sources:   []PatchSource{},
+				order:     newKeyOrder(),
 			})
-			partition.sources = next
-			partitions[*gvk] = partition
-		} else {
-			partitions[*gvk] = PatchPartition{
-				gvk:  *gvk,
-				base: JSONObject{},
-				sources: []PatchSource{{
-					name:     name,
-					original: resource,
-					patch:    JSONObject{},
-				}},
+		}
+		partitions[index].order.merge(document.order)
+		partitions[index].sources = append(partitions[index].sources, PatchSource{
+			identity: identity,
+			provenance: Provenance{
+				Position: document.Position,
+				Comment:  document.Comment,
+			},
+			original: resource,
+			patch:    JSONObject{},
+		})
+	}
+	return partitions, errs
+}
+
+// decomposePartition computes the base, layers and patches of a partition. Problems with individual sources, such
+// as a missing schema or merge key, are checked upfront and reported together as an ErrorList.
+func (pg *PatchGenerator) decomposePartition(ctx context.Context, pool *workerPool, partition *PatchPartition) error {
+	partition.strategy = StrategicMergePatchStrategy
+	partition.format = pg.options.PatchFormat
+	patchMeta, err := pg.schemaClient.GetPatchMetadata(partition.gvk)
+	if err != nil {
+		if !pg.options.FallbackToMergePatch {
+			errs := ErrorList{}
+			for _, source := range partition.sources {
+				errs = append(errs, locateError(&SchemaNotFoundError{}, partition.gvk, source))
 			}
+			return errs
 		}
+		partition.strategy = JSONMergePatchStrategy
+		patchMeta = jsonMergePatchMeta
 	}
-	outputPartitions := map[schema.GroupVersionKind]PatchPartition{}
-	for gvk, partition := range partitions {
-		patchMeta, err := pg.schemaClient.GetPatchMetadata(gvk)
+	partition.patchMeta = patchMeta
+	partition.customResource = pg.schemaClient.IsCustomResource(partition.gvk)
+	ignored := fieldRules(pg.options.FieldRules, IgnoreRule, partition.gvk)
+	for i := range partition.sources {
+		partition.sources[i].original = removeSelectedFields(partition.sources[i].original, ignored, patchMeta)
+	}
+	errs := ErrorList{}
+	for _, source := range partition.sources {
+		err = checkMergeKeys(source.original, "", patchMeta)
 		if err != nil {
-			return nil, err
+			errs = append(errs, locateError(err, partition.gvk, source))
 		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	if pg.options.BaseThreshold > 0 && pg.options.BaseThreshold < 100 {
+		originals := make([]JSONObject, 0, len(partition.sources))
+		for _, source := range partition.sources {
+			originals = append(originals, source.original)
+		}
+		partition.base, err = majorityBase(originals, pg.options.BaseThreshold, patchMeta)
+		if err != nil {
+			return err
+		}
+	} else {
 		partition.base = cloneJSON(partition.sources[0].original)
 		for i := 1; i < len(partition.sources); i++ {
-			other := partition.sources[i]
-			patch, err := calculatePatch(other.original, partition.base, patchMeta)
-			if err != nil {
-				return nil, err
+			if err = ctx.Err(); err != nil {
+				return err
 			}
-			nextBase, err := subtractObject(partition.base, patch, k8spatch.PatchMeta{}, patchMeta)
+			partition.base, err = intersectObjects(partition.base, partition.sources[i].original, patchMeta)
 			if err != nil {
-				return nil, err
+				return locateError(err, partition.gvk, partition.sources[i])
 			}
-			partition.base = nextBase
 		}
-		for i := 0; i < len(partition.sources); i++ {
-			item := partition.sources[i]
-			patch, err := calculatePatch(partition.base, item.original, patchMeta)
-			if err != nil {
-				return nil, err
-			}
-			orderedPatch, err := ExecutePatchOrdering(patch)
-			if err != nil {
-				return nil, err
-			}
-			item.patch = orderedPatch
-			partition.sources[i] = item
+	}
+	// fields pinned to the base must be the same in every source, which the first source stands in for
+	pinnedToBase := fieldRules(pg.options.FieldRules, PinToBaseRule, partition.gvk)
+	for _, source := range partition.sources[1:] {
+		err = checkPinnedFields(partition.sources[0].original, source.original, pinnedToBase, patchMeta)
+		if err != nil {
+			errs = append(errs, locateError(err, partition.gvk, source))
 		}
-		outputPartitions[gvk] = partition
 	}
+	if len(errs) > 0 {
+		return errs
+	}
+	pinnedToPatch := fieldRules(pg.options.FieldRules, PinToPatchRule, partition.gvk)
+	partition.base = removeSelectedFields(partition.base, pinnedToPatch, patchMeta)
+	if pg.options.LayerSimilarity > 0 {
+		err = partition.buildLayers(pg.options.LayerSimilarity, pinnedToPatch)
+		if err != nil {
+			return err
+		}
+	}
+	// the patches of the sources only read the bases computed above, so they are computed concurrently
+	sourceErrs := pool.forEach(ctx, len(partition.sources), func(i int) error {
+		item := partition.sources[i]
+		base := partition.layerBase(item.layer)
+		patch, err := calculatePatch(base, item.original, patchMeta)
+		if err != nil {
+			return locateError(err, partition.gvk, item)
+		}
+		orderedPatch, err := orderPatch(base, item.original, patch, patchMeta)
+		if err != nil {
+			return err
+		}
+		item.patch = orderedPatch
+		if partition.format == JSON6902PatchFormat {
+			item.operations = createJSONPatch("", base, item.original)
+		}
+		partition.sources[i] = item
+		return nil
+	})
+	for _, err := range sourceErrs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	results := make([]PatchPartition, 0, len(outputPartitions))
-	for _, value := range outputPartitions {
-		results = append(results, value)
+func compareGVK(a schema.GroupVersionKind, b schema.GroupVersionKind) int {
+	if a.Group != b.Group {
+		return strings.Compare(a.Group, b.Group)
+	}
+	if a.Version != b.Version {
+		return strings.Compare(a.Version, b.Version)
 	}
-	return results, nil
+	return strings.Compare(a.Kind, b.Kind)
+}
+
+func (pgr *PatchPartition) Summary() string {
+	name := pgr.gvk.String()
+	if pgr.namespace != "" {
+		name = fmt.Sprintf("%s, namespace %s", name, pgr.namespace)
+	}
+	if len(pgr.layers) > 0 {
+		return fmt.Sprintf("%s: %d resources, %d layers, %s patches", name, len(pgr.sources), len(pgr.layers), pgr.strategy)
+	}
+	return fmt.Sprintf("%s: %d resources, %s patches", name, len(pgr.sources), pgr.strategy)
+}
+
+// describeLocation returns the position of a resource if it is known, or its index in the input otherwise.
+func describeLocation(index int, position SourcePosition) string {
+	if position.Line > 0 {
+		return position.String()
+	}
+	return fmt.Sprintf("resource #%d", index+1)
 }
 
 func GetResourceName(resource JSONObject) (string, error) {
@@ -202,6 +645,15 @@ func GetResourceName(resource JSONObject) (string, error) {
 	return "", fmt.Errorf("required attribute 'name' not found in resource metadata")
 }
 
+func GetResourceNamespace(resource JSONObject) string {
+	if metadata, ok := resource["metadata"].(JSONObject); ok {
+		if namespace, ok := metadata["namespace"].(string); ok {
+			return namespace
+		}
+	}
+	return ""
+}
+
 func calculatePatch(content JSONObject, other JSONObject, lookupMeta k8spatch.LookupPatchMeta) (JSONObject, error) {
 	contentBytes, err := json.Marshal(content)
 	if err != nil {
@@ -223,7 +675,152 @@ func calculatePatch(content JSONObject, other JSONObject, lookupMeta k8spatch.Lo
 	return patch, nil
 }
 
-func subtractObject(a JSONObject, b JSONObject, patchMeta k8spatch.PatchMeta, patchContext k8spatch.LookupPatchMeta) (JSONObject, error) {
+// intersectObjects keeps only the parts of a that are also present in b.
+func intersectObjects(a JSONObject, b JSONObject, lookupMeta k8spatch.LookupPatchMeta) (JSONObject, error) {
+	patch, err := calculatePatch(b, a, lookupMeta)
+	if err != nil {
+		return nil, err
+	}
+	subtracted, err := subtractObject(a, patch, k8spatch.PatchMeta{}, lookupMeta, "")
+	if err != nil {
+		return nil, err
+	}
+	return retainSharedListItems(subtracted, b, lookupMeta)
+}
+
+// retainSharedListItems drops the items of merged lists in a that have no item with the same merge key in b.
+// Subtracting a patch cannot tell those apart from items that are in both but differ in every other field.
+func retainSharedListItems(a JSONObject, b JSONObject, lookupMeta k8spatch.LookupPatchMeta) (JSONObject, error) {
+	result := JSONObject{}
+	for k, aValue := range a {
+		result[k] = aValue
+		switch typedAValue := aValue.(type) {
+		case JSONObject:
+			typedBValue, ok := b[k].(JSONObject)
+			if !ok {
+				continue
+			}
+			fieldMeta, _, err := lookupMeta.LookupPatchMetadataForStruct(k)
+			if err != nil {
+				return nil, err
+			}
+			result[k], err = retainSharedListItems(typedAValue, typedBValue, fieldMeta)
+			if err != nil {
+				return nil, err
+			}
+		case JSONArray:
+			typedBValue, ok := b[k].(JSONArray)
+			if !ok {
+				continue
+			}
+			itemMeta, patchMeta, err := lookupMeta.LookupPatchMetadataForSlice(k)
+			if err != nil {
+				return nil, err
+			}
+			mergeKey := patchMeta.GetPatchMergeKey()
+			if !shouldSubtractList(patchMeta) || mergeKey == "" {
+				continue
+			}
+			items := JSONArray{}
+			for _, item := range typedAValue {
+				typedItem, ok := item.(JSONObject)
+				if !ok {
+					items = append(items, item)
+					continue
+				}
+				bItem, ok := findListItem(typedBValue, mergeKey, typedItem[mergeKey])
+				if !ok {
+					continue
+				}
+				retained, err := retainSharedListItems(typedItem, bItem, itemMeta)
+				if err != nil {
+					return nil, err
+				}
+				items = append(items, retained)
+			}
+			result[k] = items
+		}
+	}
+	return result, nil
+}
+
+// checkMergeKeys returns a MissingMergeKeyError for the first item of a list merged by key that lacks its merge key.
+func checkMergeKeys(object JSONObject, path string, lookupMeta k8spatch.LookupPatchMeta) error {
+	keys := make([]string, 0, len(object))
+	for k := range object {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		switch typedValue := object[k].(type) {
+		case JSONObject:
+			fieldMeta, _, err := lookupMeta.LookupPatchMetadataForStruct(k)
+			if err != nil {
+				continue
+			}
+			err = checkMergeKeys(typedValue, appendFieldPath(path, k), fieldMeta)
+			if err != nil {
+				return err
+			}
+		case JSONArray:
+			itemMeta, patchMeta, err := lookupMeta.LookupPatchMetadataForSlice(k)
+			if err != nil {
+				continue
+			}
+			mergeKey := patchMeta.GetPatchMergeKey()
+			if !shouldSubtractList(patchMeta) || mergeKey == "" {
+				continue
+			}
+			for i, item := range typedValue {
+				typedItem, ok := item.(JSONObject)
+				if !ok {
+					continue
+				}
+				itemPath := appendIndexPath(appendFieldPath(path, k), i)
+				if _, ok := typedItem[mergeKey]; !ok {
+					return &MissingMergeKeyError{ResourceLocation{Path: itemPath}, mergeKey}
+				}
+				err = checkMergeKeys(typedItem, itemPath, itemMeta)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func findListItem(list JSONArray, mergeKey string, mergeValue JSONValue) (JSONObject, bool) {
+	for _, item := range list {
+		if typedItem, ok := item.(JSONObject); ok && reflect.DeepEqual(typedItem[mergeKey], mergeValue) {
+			return typedItem, true
+		}
+	}
+	return nil, false
+}
+
+func applyPatch(content JSONObject, patch JSONObject, lookupMeta k8spatch.LookupPatchMeta) (JSONObject, error) {
+	contentBytes, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	patchBytes, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+	resultBytes, err := k8spatch.StrategicMergePatchUsingLookupPatchMeta(contentBytes, patchBytes, lookupMeta)
+	if err != nil {
+		return nil, err
+	}
+	var result JSONObject
+	err = json.Unmarshal(resultBytes, &result)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func subtractObject(a JSONObject, b JSONObject, patchMeta k8spatch.PatchMeta, patchContext k8spatch.LookupPatchMeta, path string) (JSONObject, error) {
 	result := JSONObject{}
 	for k, aValue := range a {
 		if bValue, ok := b[k]; ok {
@@ -234,7 +831,7 @@ func subtractObject(a JSONObject, b JSONObject, patchMeta k8spatch.PatchMeta, pa
 					if err != nil {
 						return nil, err
 					}
-					result[k], err = subtractObject(typedAValue, typedBValue, patchMeta, lookupMeta)
+					result[k], err = subtractObject(typedAValue, typedBValue, patchMeta, lookupMeta, appendFieldPath(path, k))
 					if err != nil {
 						return nil, err
 					}
@@ -249,12 +846,13 @@ func subtractObject(a JSONObject, b JSONObject, patchMeta k8spatch.PatchMeta, pa
 						return nil, err
 					}
 					if shouldSubtractList(patchMeta) {
-						result[k], err = subtractList(typedAValue, typedBValue, patchMeta, lookupMeta)
+						result[k], err = subtractList(typedAValue, typedBValue, patchMeta, lookupMeta, appendFieldPath(path, k))
 						if err != nil {
 							return nil, err
 						}
-						continue
 					}
+					// lists that are not merged are replaced as a whole by any patch touching them
+					continue
 				} else {
 					log.Default().Printf("unexpected type mismatch while evaluating key '%s'\n", k)
 				}
@@ -269,12 +867,12 @@ func subtractObject(a JSONObject, b JSONObject, patchMeta k8spatch.PatchMeta, pa
 	return result, nil
 }
 
-func subtractList(a JSONArray, b JSONArray, listPatchMetadata k8spatch.PatchMeta, listSchema k8spatch.LookupPatchMeta) (JSONArray, error) {
+func subtractList(a JSONArray, b JSONArray, listPatchMetadata k8spatch.PatchMeta, listSchema k8spatch.LookupPatchMeta, path string) (JSONArray, error) {
 	result := JSONArray{}
-	for _, aValue := range a {
+	for i, aValue := range a {
 		switch typedAValue := aValue.(type) {
 		case JSONObject:
-			subtractedItem, err := subtractObjectListItem(typedAValue, b, listPatchMetadata, listSchema)
+			subtractedItem, err := subtractObjectListItem(typedAValue, b, listPatchMetadata, listSchema, appendIndexPath(path, i))
 			if err != nil {
 				return nil, err
 			}
@@ -290,21 +888,21 @@ func subtractList(a JSONArray, b JSONArray, listPatchMetadata k8spatch.PatchMeta
 	}
 	return result, nil
 }
-func subtractObjectListItem(aValue JSONObject, b JSONArray, patchMeta k8spatch.PatchMeta, patchContext k8spatch.LookupPatchMeta) (JSONObject, error) {
+func subtractObjectListItem(aValue JSONObject, b JSONArray, patchMeta k8spatch.PatchMeta, patchContext k8spatch.LookupPatchMeta, path string) (JSONObject, error) {
 	mergeKey := patchMeta.GetPatchMergeKey()
 	aMergeValue, ok := aValue[mergeKey]
 	if !ok {
-		return nil, fmt.Errorf("unexpected missing merge key")
+		return nil, &MissingMergeKeyError{ResourceLocation{Path: path}, mergeKey}
 	}
 	for _, bValue := range b {
 		switch typedBValue := bValue.(type) {
 		case JSONObject:
 			bMergeValue, ok := typedBValue[mergeKey]
 			if !ok {
-				return nil, fmt.Errorf("unexpected missing merge key")
+				return nil, &MissingMergeKeyError{ResourceLocation{Path: path}, mergeKey}
 			}
 			if aMergeValue == bMergeValue {
-				subtractedObject, err := subtractObject(aValue, typedBValue, patchMeta, patchContext)
+				subtractedObject, err := subtractObject(aValue, typedBValue, patchMeta, patchContext, path)
 				if err != nil {
 					return nil, err
 				}
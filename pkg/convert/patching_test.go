@@ -1,7 +1,12 @@
 package convert
 
 import (
+	"context"
+	"encoding/json"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"os"
+	"path"
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -193,11 +198,12 @@ func Test_Diff(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	pg, err := NewPatchGenerator("/Users/amannmalik/IdeaProjects/kubernetes/api/openapi-spec/v3")
+	sc, err := NewKubeSchemaClient("")
 	if err != nil {
 		t.Fatal(err)
 	}
-	results, err := pg.Execute(objects)
+	pg := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{})
+	results, err := pg.Execute(context.Background(), objects)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -221,6 +227,19 @@ func Test_Diff(t *testing.T) {
 		t.Fatal(err)
 	}
 
+	for _, source := range result.Sources() {
+		if source.Namespace() != "cert-manager" {
+			t.Fatalf("unexpected namespace for '%s': %s", source.Name(), source.Namespace())
+		}
+		reapplied, err := applyPatch(result.Base(), source.Patch(), result.patchMeta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(reapplied, source.Original()) {
+			t.Fatalf("patch for '%s' does not reproduce the original", source.Name())
+		}
+	}
+
 	t.Log(string(baseYAML))
 	consolidated := []string{}
 	for _, patch := range patches {
@@ -245,27 +264,21 @@ func Test_Big_CRDs(t *testing.T) {
 		inputObjects = append(inputObjects, result...)
 	}
 	t.Logf("total input lines: %d", lineCount)
-	pg, err := NewPatchGenerator("/Users/amannmalik/IdeaProjects/kubernetes/api/openapi-spec/v3")
+	sc, err := NewKubeSchemaClient("")
 	if err != nil {
 		t.Fatal(err)
 	}
-	results, err := pg.Execute(inputObjects)
+	pg := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{})
+	results, err := pg.Execute(context.Background(), inputObjects)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if len(results) < 1 {
 		t.Fatal(err)
 	}
-	err = os.RemoveAll("/Users/amannmalik/IdeaProjects/config-tool/out")
-	if err != nil {
-		return
-	}
-	err = os.Mkdir("/Users/amannmalik/IdeaProjects/config-tool/out", 0755)
-	if err != nil {
-		return
-	}
+	outputDir := t.TempDir()
 	for _, result := range results {
-		t.Logf("--- resource type: %s", result.gvk.String())
+		t.Logf("--- resource type: %s", result.GVK().String())
 
 		originalYAMLs, err := result.GetOriginalYAMLs()
 		if err != nil {
@@ -295,10 +308,368 @@ func Test_Big_CRDs(t *testing.T) {
 		merged := strings.Join(consolidated, "---\n")
 		t.Logf("    total patch lines: %d", strings.Count(merged, "\n"))
 
-		err = result.DumpToFolder("/Users/amannmalik/IdeaProjects/config-tool/out")
+		err = result.DumpToFolder(outputDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+}
+
+func Test_FallbackToMergePatch(t *testing.T) {
+	objects, err := ParseYAMLFileIntoJSONObjects([]byte(`apiVersion: example.com/v1
+kind: Unknown
+metadata:
+  name: first
+spec:
+  items: [a, b]
+  shared: true
+---
+apiVersion: example.com/v1
+kind: Unknown
+metadata:
+  name: second
+spec:
+  items: [a, c]
+  shared: true
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).Execute(context.Background(), objects)
+	if err == nil {
+		t.Fatal("expected unknown kinds to fail without a fallback")
+	}
+	results, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{FallbackToMergePatch: true}).Execute(context.Background(), objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Strategy() != JSONMergePatchStrategy {
+		t.Fatalf("expected a single json-merge partition, got %v", results)
+	}
+	expectedBase := JSONObject{
+		"apiVersion": "example.com/v1",
+		"kind":       "Unknown",
+		"metadata":   JSONObject{},
+		"spec":       JSONObject{"shared": true},
+	}
+	if !reflect.DeepEqual(results[0].base, expectedBase) {
+		t.Fatalf("unexpected base: %v", results[0].base)
+	}
+	mismatches, err := results[0].Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) > 0 {
+		t.Fatalf("unexpected verification mismatches: %v", mismatches)
+	}
+}
+
+func Test_PartitionOrder(t *testing.T) {
+	objects, err := ParseYAMLFileIntoJSONObjects([]byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: b
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: d
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: a
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: c
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[PartitionOrder][]string{
+		GVKPartitionOrder:        {"ConfigMap", "ServiceAccount", "Deployment"},
+		AppearancePartitionOrder: {"ServiceAccount", "Deployment", "ConfigMap"},
+	}
+	for order, expectedKinds := range tests {
+		results, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{PartitionOrder: order}).Execute(context.Background(), objects)
 		if err != nil {
-			return
+			t.Fatal(err)
+		}
+		kinds := []string{}
+		for _, result := range results {
+			kinds = append(kinds, result.GVK().Kind)
+		}
+		if !reflect.DeepEqual(kinds, expectedKinds) {
+			t.Fatalf("unexpected %s partition order: %v", order, kinds)
+		}
+		for _, result := range results {
+			if result.GVK().Kind == "ServiceAccount" && !reflect.DeepEqual(result.SourceNames(), []string{"b", "a"}) {
+				t.Fatalf("expected sources in input order, got %v", result.SourceNames())
+			}
+		}
+	}
+}
+
+func Test_ResourceIdentity(t *testing.T) {
+	objects, err := ParseYAMLFileIntoJSONObjects([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: staging
+spec:
+  replicas: 1
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: api
+  namespace: production
+spec:
+  replicas: 3
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).Execute(context.Background(), objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || !reflect.DeepEqual(results[0].SourceNames(), []string{"staging/api", "production/api"}) {
+		t.Fatalf("unexpected partitions: %v", results)
+	}
+	outputDir := t.TempDir()
+	err = results[0].DumpToFolder(outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"staging_api.yaml", "production_api.yaml"} {
+		if _, err := os.Stat(path.Join(outputDir, results[0].folderName(), name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{PartitionByNamespace: true}).Execute(context.Background(), objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	namespaces := []string{}
+	for _, result := range results {
+		namespaces = append(namespaces, result.Namespace())
+	}
+	if !reflect.DeepEqual(namespaces, []string{"production", "staging"}) {
+		t.Fatalf("unexpected partition namespaces: %v", namespaces)
+	}
+	if summary := results[0].Summary(); summary != "apps/v1, Kind=Deployment, namespace production: 1 resources, strategic-merge patches" {
+		t.Fatalf("unexpected summary: %s", summary)
+	}
+
+	roles, err := ParseYAMLFileIntoJSONObjects([]byte(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: _partition
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).Execute(context.Background(), roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = results[0].DumpToFolder(t.TempDir())
+	if err == nil || err.Error() != "ClusterRole '_partition' cannot be written to the folder layout, as its patch file would replace the partition file '_partition.yaml'" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).Execute(context.Background(), append(objects, objects[0]))
+	if err == nil || !strings.Contains(err.Error(), "duplicates resource #1") {
+		t.Fatalf("expected duplicate resource error, got %v", err)
+	}
+}
+
+func Test_MajorityBase(t *testing.T) {
+	objects, err := ParseYAMLFileIntoJSONObjects([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: a
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0
+      - name: sidecar
+        image: proxy:1.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: b
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:1.0
+      - name: sidecar
+        image: proxy:1.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: outlier
+spec:
+  replicas: 5
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:2.0
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{BaseThreshold: 60}).Execute(context.Background(), objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedBase := JSONObject{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   JSONObject{},
+		"spec": JSONObject{
+			"replicas": 2.0,
+			"template": JSONObject{"spec": JSONObject{"containers": JSONArray{
+				JSONObject{"name": "app", "image": "app:1.0"},
+				JSONObject{"name": "sidecar", "image": "proxy:1.0"},
+			}}},
+		},
+	}
+	if !reflect.DeepEqual(results[0].Base(), expectedBase) {
+		t.Fatalf("unexpected base: %v", results[0].Base())
+	}
+	if patch := results[0].Sources()[0].Patch(); !reflect.DeepEqual(patch, JSONObject{"metadata": JSONObject{"name": "a"}}) {
+		t.Fatalf("unexpected majority patch: %v", patch)
+	}
+	outlierPatch, _ := json.Marshal(results[0].Sources()[2].Patch())
+	if !strings.Contains(string(outlierPatch), `"$patch":"delete"`) {
+		t.Fatalf("expected outlier patch to delete the sidecar: %s", outlierPatch)
+	}
+	mismatches, err := results[0].Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mismatches) > 0 {
+		t.Fatalf("unexpected mismatches: %v", mismatches)
+	}
+	outputDir := t.TempDir()
+	err = DumpToKustomization(results, outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, source := range results[0].Sources() {
+		built := kustomizeBuild(t, path.Join(outputDir, "overlays", results[0].folderName(), source.Name()))
+		if len(built) != 1 || !reflect.DeepEqual(built[0], source.Original()) {
+			t.Fatalf("kustomize overlay of '%s' does not reproduce the original: %v", source.Name(), built)
 		}
 	}
+}
+
+func Test_ExecutePatchOrdering(t *testing.T) {
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	patchMeta, err := sc.GetPatchMetadata(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployment := func(containers ...JSONObject) JSONObject {
+		items := JSONArray{}
+		for _, container := range containers {
+			items = append(items, container)
+		}
+		return JSONObject{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   JSONObject{"name": "web"},
+			"spec":       JSONObject{"template": JSONObject{"spec": JSONObject{"containers": items}}},
+		}
+	}
+	app := JSONObject{"name": "app", "image": "app:1", "args": JSONArray{"--one", "--two"}}
+	side := JSONObject{"name": "side", "image": "side:1"}
+	base := deployment(app, side)
+	tests := map[string]struct {
+		original   JSONObject
+		directives bool
+	}{
+		"reordered":             {deployment(side, app), true},
+		"reordered and changed": {deployment(side, JSONObject{"name": "app", "image": "app:2"}), true},
+		"changed in order":      {deployment(app, JSONObject{"name": "side", "image": "side:2"}), false},
+		"appended":              {deployment(app, side, JSONObject{"name": "extra", "image": "extra:1"}), true},
+		"scalar list reordered": {deployment(JSONObject{"name": "app", "image": "app:1", "args": JSONArray{"--two", "--one"}}, side), false},
+		"removed and reordered": {deployment(JSONObject{"name": "extra", "image": "extra:1"}, side), false},
+	}
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			patch, err := calculatePatch(base, test.original, patchMeta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ordered, err := orderPatch(base, test.original, patch, patchMeta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			applied, err := applyPatch(base, ordered, patchMeta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(applied, test.original) {
+				t.Fatalf("patch %v does not reproduce the original: %v", ordered, applied)
+			}
+			content, _ := json.Marshal(ordered)
+			if strings.Contains(string(content), setElementOrderPrefix) != test.directives {
+				t.Fatalf("unexpected directives in patch: %s", content)
+			}
+		})
+	}
 
+	documents := []ManifestDocument{{Object: deployment(app, side)}, {Object: deployment(side, app)}, {Object: deployment(app, side)}}
+	for i, name := range []string{"first", "second", "third"} {
+		documents[i].Object = cloneJSON(documents[i].Object)
+		documents[i].Object["metadata"] = JSONObject{"name": name}
+	}
+	for _, options := range []PatchGeneratorOptions{{}, {BaseThreshold: 50}, {LayerSimilarity: 0.1}} {
+		results, err := NewPatchGeneratorFromSchemaClient(sc, options).ExecuteDocuments(context.Background(), documents)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mismatches, err := results[0].Verify()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(mismatches) > 0 {
+			t.Fatalf("unexpected mismatches with options %+v: %v", options, mismatches)
+		}
+	}
 }
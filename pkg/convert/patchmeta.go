@@ -0,0 +1,250 @@
+package convert
+
+import (
+	"encoding/json"
+	k8spatch "k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"strings"
+)
+
+const (
+	patchStrategyExtensionKey = "x-kubernetes-patch-strategy"
+	patchMergeKeyExtensionKey = "x-kubernetes-patch-merge-key"
+	listTypeExtensionKey      = "x-kubernetes-list-type"
+	listMapKeysExtensionKey   = "x-kubernetes-list-map-keys"
+	objectMetaModelName       = "io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"
+)
+
+// schemaPatchMeta is a lenient LookupPatchMeta over proto.Schema: fields that are missing from the
+// schema or typed as arbitrary values resolve to empty patch metadata rather than an error or nil.
+//
+// It stands in for k8spatch.PatchMetaFromOpenAPI, which fails with a FieldNotFoundError on the first field
+// its schema does not declare. Manifests routinely carry such fields: CRD schemas leave `metadata` untyped
+// and mark whole subtrees with `x-kubernetes-preserve-unknown-fields`, and resources written against a newer
+// API version add fields an older bundled schema lacks. Those fields are merged like JSON merge patches would
+// merge them. It also reads `x-kubernetes-list-type` for CRD lists, which only declare merge semantics that way.
+type schemaPatchMeta struct {
+	schema proto.Schema
+}
+
+func newSchemaPatchMeta(s proto.Schema) k8spatch.LookupPatchMeta {
+	return schemaPatchMeta{s}
+}
+
+func (m schemaPatchMeta) LookupPatchMetadataForStruct(key string) (k8spatch.LookupPatchMeta, k8spatch.PatchMeta, error) {
+	field := lookupFieldSchema(m.schema, key)
+	return schemaPatchMeta{field}, parsePatchMeta(field), nil
+}
+
+func (m schemaPatchMeta) LookupPatchMetadataForSlice(key string) (k8spatch.LookupPatchMeta, k8spatch.PatchMeta, error) {
+	field := lookupFieldSchema(m.schema, key)
+	var item proto.Schema
+	if array, ok := resolveSchema(field).(*proto.Array); ok {
+		item = array.SubType
+	}
+	return schemaPatchMeta{item}, parsePatchMeta(field), nil
+}
+
+func (m schemaPatchMeta) Name() string {
+	if m.schema == nil {
+		return ""
+	}
+	return m.schema.GetName()
+}
+
+// resourcePatchMeta is the patch metadata of a top-level resource, which falls back to the builtin
+// ObjectMeta schema when the resource schema leaves `metadata` untyped, as CRD schemas usually do.
+type resourcePatchMeta struct {
+	schemaPatchMeta
+	objectMeta *proto.Schema
+}
+
+func newResourcePatchMeta(s proto.Schema, objectMeta *proto.Schema) k8spatch.LookupPatchMeta {
+	return resourcePatchMeta{schemaPatchMeta{s}, objectMeta}
+}
+
+func (m resourcePatchMeta) LookupPatchMetadataForStruct(key string) (k8spatch.LookupPatchMeta, k8spatch.PatchMeta, error) {
+	if key == "metadata" && m.objectMeta != nil {
+		if _, ok := resolveSchema(lookupFieldSchema(m.schema, key)).(*proto.Kind); !ok {
+			return schemaPatchMeta{*m.objectMeta}, k8spatch.PatchMeta{}, nil
+		}
+	}
+	return m.schemaPatchMeta.LookupPatchMetadataForStruct(key)
+}
+
+func resolveSchema(s proto.Schema) proto.Schema {
+	for {
+		ref, ok := s.(proto.Reference)
+		if !ok {
+			return s
+		}
+		s = ref.SubSchema()
+	}
+}
+
+func lookupFieldSchema(s proto.Schema, key string) proto.Schema {
+	switch typed := resolveSchema(s).(type) {
+	case *proto.Kind:
+		return typed.Fields[key]
+	case *proto.Map:
+		return typed.SubType
+	}
+	return nil
+}
+
+func parsePatchMeta(s proto.Schema) k8spatch.PatchMeta {
+	patchMeta := k8spatch.PatchMeta{}
+	if s == nil {
+		return patchMeta
+	}
+	extensions := s.GetExtensions()
+	if strategy, ok := extensions[patchStrategyExtensionKey].(string); ok {
+		patchMeta.SetPatchStrategies(strings.Split(strategy, ","))
+	}
+	if mergeKey, ok := extensions[patchMergeKeyExtensionKey].(string); ok {
+		patchMeta.SetPatchMergeKey(mergeKey)
+	}
+	if len(patchMeta.GetPatchStrategies()) > 0 {
+		return patchMeta
+	}
+	switch extensions[listTypeExtensionKey] {
+	case "set":
+		patchMeta.SetPatchStrategies([]string{"merge"})
+	case "map":
+		// Strategic merge patches can only merge list items by a single key. Merging by the first of several keys
+		// would treat items that only differ by the other keys, such as ports that share a number but not a
+		// protocol, as the same item, so such lists are left atomic and replaced as a whole instead.
+		if mapKeys, ok := extensions[listMapKeysExtensionKey].(JSONArray); ok && len(mapKeys) == 1 {
+			if mergeKey, ok := mapKeys[0].(string); ok {
+				patchMeta.SetPatchStrategies([]string{"merge"})
+				patchMeta.SetPatchMergeKey(mergeKey)
+			}
+		}
+	}
+	return patchMeta
+}
+
+// normalizeSchemaDocument rewrites the `allOf: [{$ref: ...}]` wrappers used by the Kubernetes OpenAPI v3
+// documents into plain references, which is the only form proto.NewOpenAPIV3Data resolves. Parsers ignore the
+// keys next to a `$ref`, such as `x-kubernetes-patch-strategy` or `default`, so the keys of every wrapper are
+// returned for applyReferenceSiblings to restore on the parsed references.
+func normalizeSchemaDocument(data []byte) ([]byte, []referenceSiblings, error) {
+	var doc JSONValue
+	err := json.Unmarshal(data, &doc)
+	if err != nil {
+		return nil, nil, err
+	}
+	siblings := []referenceSiblings{}
+	if typedDoc, ok := doc.(JSONObject); ok {
+		if components, ok := typedDoc["components"].(JSONObject); ok {
+			if schemas, ok := components["schemas"].(JSONObject); ok {
+				for name, modelSchema := range schemas {
+					schemas[name] = unwrapAllOfReferences(modelSchema, name, []string{}, &siblings)
+				}
+			}
+		}
+	}
+	content, err := json.Marshal(unwrapAllOfReferences(doc, "", nil, nil))
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, siblings, nil
+}
+
+// referenceSiblings are the keys next to a wrapped reference, found in a model by the path of document keys
+// leading to the reference.
+type referenceSiblings struct {
+	model string
+	path  []string
+	keys  JSONObject
+}
+
+// unwrapAllOfReferences rewrites the wrappers within v, recording their keys in siblings when path is known.
+func unwrapAllOfReferences(v JSONValue, model string, path []string, siblings *[]referenceSiblings) JSONValue {
+	switch typed := v.(type) {
+	case JSONObject:
+		if allOf, ok := typed["allOf"].(JSONArray); ok && len(allOf) == 1 {
+			if ref, ok := allOf[0].(JSONObject); ok {
+				if _, ok := ref["$ref"].(string); ok {
+					keys := JSONObject{}
+					for k, value := range typed {
+						if k != "allOf" && k != "description" {
+							keys[k] = value
+						}
+					}
+					if description, ok := typed["description"]; ok {
+						ref["description"] = description
+					}
+					if len(keys) > 0 && path != nil {
+						*siblings = append(*siblings, referenceSiblings{model, path, keys})
+					}
+					return ref
+				}
+			}
+		}
+		for k, item := range typed {
+			var itemPath []string
+			if path != nil {
+				itemPath = append(append([]string{}, path...), k)
+			}
+			typed[k] = unwrapAllOfReferences(item, model, itemPath, siblings)
+		}
+		return typed
+	case JSONArray:
+		for i, item := range typed {
+			typed[i] = unwrapAllOfReferences(item, model, nil, siblings)
+		}
+		return typed
+	}
+	return v
+}
+
+// applyReferenceSiblings sets the extensions and default found next to wrapped references on the references parsed
+// from them. Paths that lead anywhere but a field, list item or map value of a model are skipped.
+func applyReferenceSiblings(models proto.Models, siblings []referenceSiblings) {
+	for _, sibling := range siblings {
+		s := models.LookupModel(sibling.model)
+		path := sibling.path
+		for len(path) > 0 && s != nil {
+			switch typed := s.(type) {
+			case *proto.Kind:
+				if path[0] != "properties" || len(path) < 2 {
+					s = nil
+					continue
+				}
+				s = typed.Fields[path[1]]
+				path = path[2:]
+			case *proto.Array:
+				if path[0] != "items" {
+					s = nil
+					continue
+				}
+				s = typed.SubType
+				path = path[1:]
+			case *proto.Map:
+				if path[0] != "additionalProperties" {
+					s = nil
+					continue
+				}
+				s = typed.SubType
+				path = path[1:]
+			default:
+				s = nil
+			}
+		}
+		ref, ok := s.(*proto.Ref)
+		if !ok {
+			continue
+		}
+		for k, value := range sibling.keys {
+			if k == "default" {
+				ref.Default = value
+			} else if strings.HasPrefix(k, "x-") {
+				if ref.Extensions == nil {
+					ref.Extensions = map[string]interface{}{}
+				}
+				ref.Extensions[k] = value
+			}
+		}
+	}
+}
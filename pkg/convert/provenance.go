@@ -0,0 +1,41 @@
+package convert
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+const helmSourceCommentPrefix = "Source: "
+
+// Provenance records where a resource was read from.
+type Provenance struct {
+	Position SourcePosition
+	// Comment holds the comment lines that preceded the resource in its input
+	Comment string
+}
+
+// Template returns the chart template path of a rendered Helm chart `# Source:` comment, or an empty string.
+func (p Provenance) Template() string {
+	for _, line := range strings.Split(p.Comment, "\n") {
+		if strings.HasPrefix(line, helmSourceCommentPrefix) {
+			return path.Clean(strings.TrimSpace(strings.TrimPrefix(line, helmSourceCommentPrefix)))
+		}
+	}
+	return ""
+}
+
+// header returns YAML comment lines recording the provenance, or nothing if it is unknown.
+func (p Provenance) header() []byte {
+	lines := []string{}
+	if template := p.Template(); template != "" {
+		lines = append(lines, fmt.Sprintf("# Source: %s", template))
+	}
+	if p.Position.Line > 0 {
+		lines = append(lines, fmt.Sprintf("# Input: %s", p.Position))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
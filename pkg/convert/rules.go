@@ -0,0 +1,392 @@
+package convert
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8spatch "k8s.io/apimachinery/pkg/util/strategicpatch"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// scopeVersionPattern matches the versions of Kubernetes APIs, such as v1, v2beta1 or v1alpha3
+var scopeVersionPattern = regexp.MustCompile(`^v[1-9][0-9]*((alpha|beta)[1-9][0-9]*)?$`)
+
+type FieldRuleAction string
+
+const (
+	// PinToPatchRule keeps the selected fields out of bases and layers, so that every resource patch carries them
+	PinToPatchRule FieldRuleAction = "pin-to-patch"
+	// PinToBaseRule requires the selected fields to be the same in every resource, and therefore part of the base
+	PinToBaseRule FieldRuleAction = "pin-to-base"
+	// IgnoreRule removes the selected fields from every resource before decomposing it
+	IgnoreRule FieldRuleAction = "ignore"
+)
+
+// FieldRule applies an action to the fields that a selector picks out of the resources of the kinds in its scope.
+type FieldRule struct {
+	Action FieldRuleAction
+	// Scope limits the rule to a group, version and kind. Empty parts match any group, version or kind, which
+	// leaves the core group to be scoped by its version and kind.
+	Scope    schema.GroupVersionKind
+	Selector FieldSelector
+}
+
+// FieldSelector picks fields out of a resource, such as `.spec.template.spec.containers[*].image`. Segments are field
+// names, with dots escaped by a backslash, `[*]` for every item of a list, or `[key=value]` for the items of a list
+// whose key field has the value.
+type FieldSelector []selectorSegment
+
+type selectorSegment struct {
+	key string
+	// item selects list items rather than a field, those whose itemKey field is itemValue when itemKey is set
+	item      bool
+	itemKey   string
+	itemValue string
+}
+
+// ParseFieldRule parses a rule given as `ACTION:[SCOPE:]SELECTOR`, where the scope is a kind, or an apiVersion and
+// a kind as in `apps/v1/Deployment` or `v1/ConfigMap`, with `*` matching any group or version.
+func ParseFieldRule(s string) (FieldRule, error) {
+	action, rest, ok := strings.Cut(s, ":")
+	if !ok {
+		return FieldRule{}, fmt.Errorf("expected a field rule as ACTION:[SCOPE:]SELECTOR, got '%s'", s)
+	}
+	rule := FieldRule{Action: FieldRuleAction(action)}
+	if rule.Action != PinToPatchRule && rule.Action != PinToBaseRule && rule.Action != IgnoreRule {
+		return FieldRule{}, fmt.Errorf("unsupported field rule action '%s'", action)
+	}
+	if !strings.HasPrefix(rest, ".") {
+		scope, selector, ok := strings.Cut(rest, ":")
+		if !ok {
+			return FieldRule{}, fmt.Errorf("expected a field rule as ACTION:[SCOPE:]SELECTOR, got '%s'", s)
+		}
+		parts := strings.Split(scope, "/")
+		for i, part := range parts {
+			if part == "*" {
+				parts[i] = ""
+			}
+		}
+		switch len(parts) {
+		case 1:
+			rule.Scope.Kind = parts[0]
+		case 2:
+			rule.Scope.Version, rule.Scope.Kind = parts[0], parts[1]
+		case 3:
+			rule.Scope.Group, rule.Scope.Version, rule.Scope.Kind = parts[0], parts[1], parts[2]
+		default:
+			return FieldRule{}, fmt.Errorf("unsupported field rule scope '%s'", scope)
+		}
+		if rule.Scope.Version != "" && !scopeVersionPattern.MatchString(rule.Scope.Version) {
+			return FieldRule{}, fmt.Errorf("field rule scope '%s' has invalid version '%s'", scope, rule.Scope.Version)
+		}
+		rest = selector
+	}
+	var err error
+	rule.Selector, err = ParseFieldSelector(rest)
+	if err != nil {
+		return FieldRule{}, err
+	}
+	return rule, nil
+}
+
+// ParseFieldSelector parses a selector such as `.spec.template.spec.containers[name=web].image`.
+func ParseFieldSelector(s string) (FieldSelector, error) {
+	if !strings.HasPrefix(s, ".") {
+		return nil, fmt.Errorf("field selector '%s' must start with '.'", s)
+	}
+	selector := FieldSelector{}
+	key := strings.Builder{}
+	inKey := false
+	endKey := func() error {
+		if !inKey {
+			return nil
+		}
+		if key.Len() == 0 {
+			return fmt.Errorf("field selector '%s' has an empty field name", s)
+		}
+		selector = append(selector, selectorSegment{key: key.String()})
+		key.Reset()
+		inKey = false
+		return nil
+	}
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		switch r := runes[i]; {
+		case r == '\\' && inKey && i+1 < len(runes):
+			i++
+			key.WriteRune(runes[i])
+		case r == '.':
+			if err := endKey(); err != nil {
+				return nil, err
+			}
+			inKey = true
+		case r == '[':
+			if err := endKey(); err != nil {
+				return nil, err
+			}
+			end := strings.IndexRune(string(runes[i:]), ']')
+			if end < 0 {
+				return nil, fmt.Errorf("field selector '%s' has an unterminated '['", s)
+			}
+			content := string(runes[i:])[1:end]
+			if len(selector) == 0 || selector[len(selector)-1].item {
+				return nil, fmt.Errorf("field selector '%s' must have a field name before '['", s)
+			}
+			segment := selectorSegment{item: true}
+			if content != "*" {
+				var ok bool
+				segment.itemKey, segment.itemValue, ok = strings.Cut(content, "=")
+				if !ok || segment.itemKey == "" {
+					return nil, fmt.Errorf("field selector '%s' has an unsupported list item selector '[%s]'", s, content)
+				}
+			}
+			selector = append(selector, segment)
+			i += len([]rune(string(runes[i:])[:end]))
+		default:
+			if !inKey {
+				return nil, fmt.Errorf("field selector '%s' has an unexpected '%c'", s, r)
+			}
+			key.WriteRune(r)
+		}
+	}
+	if err := endKey(); err != nil {
+		return nil, err
+	}
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("field selector '%s' has no field name", s)
+	}
+	return selector, nil
+}
+
+func (s FieldSelector) String() string {
+	result := ""
+	for _, segment := range s {
+		switch {
+		case !segment.item:
+			result = appendFieldPath(result, strings.ReplaceAll(segment.key, ".", "\\."))
+		case segment.itemKey == "":
+			result += "[*]"
+		default:
+			result += fmt.Sprintf("[%s=%s]", segment.itemKey, segment.itemValue)
+		}
+	}
+	return result
+}
+
+func (r FieldRule) String() string {
+	if r.Scope.Empty() {
+		return fmt.Sprintf("%s:%s", r.Action, r.Selector)
+	}
+	return fmt.Sprintf("%s:%s:%s", r.Action, r.scopeString(), r.Selector)
+}
+
+func (r FieldRule) scopeString() string {
+	orAny := func(s string) string {
+		if s == "" {
+			return "*"
+		}
+		return s
+	}
+	return fmt.Sprintf("%s/%s/%s", orAny(r.Scope.Group), orAny(r.Scope.Version), orAny(r.Scope.Kind))
+}
+
+// ValidateFieldRules reports a selector that is both pinned to the base and pinned to patches for a kind that the
+// scopes of both rules cover, as no decomposition can satisfy both.
+func ValidateFieldRules(rules []FieldRule) error {
+	for i, pinned := range rules {
+		if pinned.Action != PinToBaseRule {
+			continue
+		}
+		for _, other := range rules {
+			if other.Action == PinToPatchRule && other.Selector.String() == pinned.Selector.String() && pinned.overlaps(other) {
+				return fmt.Errorf("field rule '%s' conflicts with field rule '%s'", rules[i], other)
+			}
+		}
+	}
+	return nil
+}
+
+// overlaps reports whether some group, version and kind is in the scope of both rules.
+func (r FieldRule) overlaps(other FieldRule) bool {
+	overlap := func(a string, b string) bool {
+		return a == "" || b == "" || a == b
+	}
+	return overlap(r.Scope.Group, other.Scope.Group) && overlap(r.Scope.Version, other.Scope.Version) && overlap(r.Scope.Kind, other.Scope.Kind)
+}
+
+func (r FieldRule) matches(gvk schema.GroupVersionKind) bool {
+	return (r.Scope.Group == "" || r.Scope.Group == gvk.Group) &&
+		(r.Scope.Version == "" || r.Scope.Version == gvk.Version) &&
+		(r.Scope.Kind == "" || r.Scope.Kind == gvk.Kind)
+}
+
+func (segment selectorSegment) matchesItem(item JSONValue) bool {
+	if segment.itemKey == "" {
+		return true
+	}
+	typedItem, ok := item.(JSONObject)
+	if !ok {
+		return false
+	}
+	value, ok := typedItem[segment.itemKey]
+	return ok && formatListKey(value) == segment.itemValue
+}
+
+// fieldRules returns the selectors of the rules with an action that apply to a GVK.
+func fieldRules(rules []FieldRule, action FieldRuleAction, gvk schema.GroupVersionKind) []FieldSelector {
+	result := []FieldSelector{}
+	for _, rule := range rules {
+		if rule.Action == action && rule.matches(gvk) {
+			result = append(result, rule.Selector)
+		}
+	}
+	return result
+}
+
+// removeSelectedFields returns a copy of object without the fields that any of the selectors pick out. The merge keys
+// of list items are never removed, and objects and lists left empty by a removal are removed as well.
+func removeSelectedFields(object JSONObject, selectors []FieldSelector, lookupMeta k8spatch.LookupPatchMeta) JSONObject {
+	if len(selectors) == 0 {
+		return object
+	}
+	result := cloneJSON(object)
+	for _, selector := range selectors {
+		removeSelectedObjectFields(result, selector, lookupMeta, "")
+	}
+	return result
+}
+
+// removeSelectedObjectFields removes the selected fields from object, reporting whether that left object empty.
+func removeSelectedObjectFields(object JSONObject, selector FieldSelector, lookupMeta k8spatch.LookupPatchMeta, mergeKey string) bool {
+	segment := selector[0]
+	value, ok := object[segment.key]
+	if !ok || segment.key == mergeKey {
+		return false
+	}
+	if len(selector) > 1 {
+		emptied := false
+		switch typedValue := value.(type) {
+		case JSONObject:
+			fieldMeta, _, err := lookupMeta.LookupPatchMetadataForStruct(segment.key)
+			if err != nil {
+				fieldMeta = jsonMergePatchMeta
+			}
+			emptied = removeSelectedObjectFields(typedValue, selector[1:], fieldMeta, "")
+		case JSONArray:
+			if !selector[1].item {
+				return false
+			}
+			itemMeta, patchMeta, err := lookupMeta.LookupPatchMetadataForSlice(segment.key)
+			if err != nil {
+				itemMeta, patchMeta = jsonMergePatchMeta, k8spatch.PatchMeta{}
+			}
+			object[segment.key] = removeSelectedItems(typedValue, selector[1:], itemMeta, patchMeta.GetPatchMergeKey())
+			emptied = len(object[segment.key].(JSONArray)) == 0
+		}
+		if !emptied {
+			return false
+		}
+	}
+	delete(object, segment.key)
+	return len(object) == 0
+}
+
+func removeSelectedItems(list JSONArray, selector FieldSelector, itemMeta k8spatch.LookupPatchMeta, mergeKey string) JSONArray {
+	segment := selector[0]
+	result := JSONArray{}
+	for _, item := range list {
+		if !segment.matchesItem(item) {
+			result = append(result, item)
+			continue
+		}
+		if len(selector) == 1 {
+			continue
+		}
+		typedItem, ok := item.(JSONObject)
+		if !ok || !removeSelectedObjectFields(typedItem, selector[1:], itemMeta, mergeKey) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// collectSelectedFields adds the values of the fields that a selector picks out of object to result, by their path.
+// Items of merged lists are addressed by their merge key or value rather than their index, which their order within
+// a base does not follow.
+func collectSelectedFields(object JSONObject, selector FieldSelector, lookupMeta k8spatch.LookupPatchMeta, path string, result map[string]JSONValue) {
+	segment := selector[0]
+	value, ok := object[segment.key]
+	if !ok {
+		return
+	}
+	fieldPath := appendFieldPath(path, segment.key)
+	if len(selector) == 1 {
+		result[fieldPath] = value
+		return
+	}
+	switch typedValue := value.(type) {
+	case JSONObject:
+		fieldMeta, _, err := lookupMeta.LookupPatchMetadataForStruct(segment.key)
+		if err != nil {
+			fieldMeta = jsonMergePatchMeta
+		}
+		collectSelectedFields(typedValue, selector[1:], fieldMeta, fieldPath, result)
+	case JSONArray:
+		if !selector[1].item {
+			return
+		}
+		itemMeta, patchMeta, err := lookupMeta.LookupPatchMetadataForSlice(segment.key)
+		if err != nil {
+			itemMeta, patchMeta = jsonMergePatchMeta, k8spatch.PatchMeta{}
+		}
+		mergeKey := patchMeta.GetPatchMergeKey()
+		for i, item := range typedValue {
+			if !selector[1].matchesItem(item) {
+				continue
+			}
+			itemPath := appendIndexPath(fieldPath, i)
+			typedItem, isObject := item.(JSONObject)
+			if isObject && mergeKey != "" {
+				if mergeValue, ok := typedItem[mergeKey]; ok {
+					itemPath = fmt.Sprintf("%s[%s=%s]", fieldPath, mergeKey, formatListKey(mergeValue))
+				}
+			} else if !isObject && shouldSubtractList(patchMeta) {
+				itemPath = fmt.Sprintf("%s[%s]", fieldPath, formatListKey(item))
+			}
+			if len(selector) == 2 {
+				result[itemPath] = item
+			} else if isObject {
+				collectSelectedFields(typedItem, selector[2:], itemMeta, itemPath, result)
+			}
+		}
+	}
+}
+
+// checkPinnedFields returns an UnsharedFieldError for the first field picked out of original by a selector that is
+// not the same in reference.
+func checkPinnedFields(reference JSONObject, original JSONObject, selectors []FieldSelector, lookupMeta k8spatch.LookupPatchMeta) error {
+	for _, selector := range selectors {
+		referenceFields := map[string]JSONValue{}
+		collectSelectedFields(reference, selector, lookupMeta, "", referenceFields)
+		originalFields := map[string]JSONValue{}
+		collectSelectedFields(original, selector, lookupMeta, "", originalFields)
+		paths := []string{}
+		for path := range referenceFields {
+			paths = append(paths, path)
+		}
+		for path := range originalFields {
+			if _, ok := referenceFields[path]; !ok {
+				paths = append(paths, path)
+			}
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			if !reflect.DeepEqual(referenceFields[path], originalFields[path]) {
+				return &UnsharedFieldError{ResourceLocation: ResourceLocation{Path: path}, Selector: selector.String()}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+package convert
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_ParseFieldRule(t *testing.T) {
+	tests := map[string]FieldRule{
+		`ignore:.metadata.annotations.example\.com/build`: {
+			Action:   IgnoreRule,
+			Selector: FieldSelector{{key: "metadata"}, {key: "annotations"}, {key: "example.com/build"}},
+		},
+		"pin-to-patch:apps/v1/Deployment:.spec.template.spec.containers[*].image": {
+			Action:   PinToPatchRule,
+			Scope:    schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"},
+			Selector: FieldSelector{{key: "spec"}, {key: "template"}, {key: "spec"}, {key: "containers"}, {item: true}, {key: "image"}},
+		},
+		"pin-to-base:v1/ConfigMap:.data": {
+			Action:   PinToBaseRule,
+			Scope:    schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"},
+			Selector: FieldSelector{{key: "data"}},
+		},
+		"pin-to-base:*/*/Deployment:.spec.template.spec.containers[name=web].image": {
+			Action:   PinToBaseRule,
+			Scope:    schema.GroupVersionKind{Kind: "Deployment"},
+			Selector: FieldSelector{{key: "spec"}, {key: "template"}, {key: "spec"}, {key: "containers"}, {item: true, itemKey: "name", itemValue: "web"}, {key: "image"}},
+		},
+	}
+	for value, expected := range tests {
+		rule, err := ParseFieldRule(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rule, expected) {
+			t.Fatalf("unexpected rule for '%s': %#v", value, rule)
+		}
+		reparsed, err := ParseFieldRule(rule.String())
+		if err != nil || !reflect.DeepEqual(reparsed, rule) {
+			t.Fatalf("rule '%s' does not round-trip through '%s'", value, rule.String())
+		}
+	}
+	for _, invalid := range []string{".spec", "keep:.spec", "ignore:spec", "ignore:a/b/c/d:.spec", "ignore:.spec[", "ignore:.spec[name]", "ignore:.[*]", "ignore:.spec..replicas", "ignore:apps/Deployment:.spec", "ignore:apps/v1beta/Deployment:.spec"} {
+		if _, err := ParseFieldRule(invalid); err == nil {
+			t.Fatalf("expected an error for '%s'", invalid)
+		}
+	}
+}
+
+func Test_ValidateFieldRules(t *testing.T) {
+	parse := func(values ...string) []FieldRule {
+		rules := []FieldRule{}
+		for _, value := range values {
+			rule, err := ParseFieldRule(value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rules = append(rules, rule)
+		}
+		return rules
+	}
+	err := ValidateFieldRules(parse("pin-to-base:Deployment:.spec.replicas", "pin-to-patch:apps/v1/Deployment:.spec.replicas"))
+	if err == nil || err.Error() != "field rule 'pin-to-base:*/*/Deployment:.spec.replicas' conflicts with field rule 'pin-to-patch:apps/v1/Deployment:.spec.replicas'" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, rules := range [][]FieldRule{
+		parse("pin-to-base:Deployment:.spec.replicas", "pin-to-patch:StatefulSet:.spec.replicas"),
+		parse("pin-to-base:apps/v1/Deployment:.spec.replicas", "pin-to-patch:apps/v1/Deployment:.spec.paused"),
+		parse("pin-to-base:.spec.replicas", "ignore:.spec.replicas"),
+	} {
+		if err := ValidateFieldRules(rules); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func Test_ExecuteFieldRules(t *testing.T) {
+	manifests := `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: first
+  annotations:
+    example.com/build: "101"
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:1.0
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: second
+  annotations:
+    example.com/build: "102"
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: web
+        image: web:1.0
+`
+	documents, err := ReadManifestDocuments(strings.NewReader(manifests), "rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := []FieldRule{}
+	for _, value := range []string{
+		`ignore:.metadata.annotations.example\.com/build`,
+		"pin-to-patch:apps/v1/Deployment:.spec.template.spec.containers[*].image",
+		"pin-to-base:Deployment:.spec.replicas",
+		"pin-to-patch:v1/ConfigMap:.spec.replicas",
+	} {
+		rule, err := ParseFieldRule(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rules = append(rules, rule)
+	}
+	for _, options := range []PatchGeneratorOptions{{FieldRules: rules}, {FieldRules: rules, LayerSimilarity: 0.5}} {
+		partitions, err := NewPatchGeneratorFromSchemaClient(sc, options).ExecuteDocuments(context.Background(), documents)
+		if err != nil {
+			t.Fatal(err)
+		}
+		partition := partitions[0]
+		expectedBase := JSONObject{
+			"apiVersion": "apps/v1",
+			"kind":       "Deployment",
+			"metadata":   JSONObject{},
+			"spec": JSONObject{
+				"replicas": 2.0,
+				"template": JSONObject{"spec": JSONObject{"containers": JSONArray{JSONObject{"name": "web"}}}},
+			},
+		}
+		if !reflect.DeepEqual(partition.Base(), expectedBase) {
+			t.Fatalf("unexpected base: %v", partition.Base())
+		}
+		for _, source := range partition.Sources() {
+			expectedPatch := JSONObject{
+				"metadata": JSONObject{"name": source.Name()},
+				"spec":     JSONObject{"template": JSONObject{"spec": JSONObject{"containers": JSONArray{JSONObject{"name": "web", "image": "web:1.0"}}}}},
+			}
+			if !reflect.DeepEqual(source.Patch(), expectedPatch) {
+				t.Fatalf("unexpected patch: %v", source.Patch())
+			}
+		}
+		for _, layer := range partition.Layers() {
+			if strings.Contains(fmt.Sprint(layer.Base()), "web:1.0") {
+				t.Fatalf("expected layers to leave out fields pinned to patches: %v", layer.Base())
+			}
+		}
+	}
+	if _, ok := documents[0].Object["metadata"].(JSONObject)["annotations"]; !ok {
+		t.Fatal("expected the input documents to be left untouched")
+	}
+
+	documents[1].Object = cloneJSON(documents[1].Object)
+	documents[1].Object["spec"].(JSONObject)["replicas"] = 3.0
+	_, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{FieldRules: rules}).ExecuteDocuments(context.Background(), documents)
+	var unshared *UnsharedFieldError
+	if !errors.As(err, &unshared) || unshared.Path != ".spec.replicas" || unshared.Name != "second" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err.Error() != "rules.yaml:15 (document 2) Deployment 'second' at .spec.replicas: field pinned to the base by '.spec.replicas' is not common to every resource" {
+		t.Fatalf("unexpected error message: %v", err)
+	}
+}
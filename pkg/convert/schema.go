@@ -1,71 +1,189 @@
 package convert
 
 import (
+	"compress/gzip"
 	"fmt"
+	"github.com/amannm/configism/internal/schemas"
 	openapi_v3 "github.com/google/gnostic/openapiv3"
+	"io"
+	"io/fs"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	k8spatch "k8s.io/apimachinery/pkg/util/strategicpatch"
 	"k8s.io/kube-openapi/pkg/util/proto"
 	"os"
-	"path"
 	"strings"
 )
 
 type SchemaClient struct {
 	schemaNameLookup map[string]*proto.Schema
 	gvkLookup        map[schema.GroupVersionKind]*proto.Schema
+	// customResources holds the kinds whose schema was registered from a CustomResourceDefinition
+	customResources map[schema.GroupVersionKind]bool
+	// kubeVersion is the Kubernetes minor version of the builtin schemas, empty when unknown
+	kubeVersion string
 }
 
 func NewSchemaClient(schemaFolderPath string) (*SchemaClient, error) {
-	entries, err := os.ReadDir(schemaFolderPath)
+	sc, err := NewSchemaClientFromFS(os.DirFS(schemaFolderPath))
+	if err != nil {
+		return nil, fmt.Errorf("unable to load schemas from '%s': %w", schemaFolderPath, err)
+	}
+	return sc, nil
+}
+
+// NewKubeSchemaClient loads the Kubernetes API schemas embedded for the given minor version,
+// or for schemas.DefaultKubeVersion when the version is empty.
+func NewKubeSchemaClient(kubeVersion string) (*SchemaClient, error) {
+	bundle, err := schemas.KubeSchemas(kubeVersion)
 	if err != nil {
 		return nil, err
 	}
-	schemas := map[string]*proto.Schema{}
-	gvks := map[schema.GroupVersionKind]*proto.Schema{}
+	sc, err := NewSchemaClientFromFS(bundle)
+	if err != nil {
+		return nil, err
+	}
+	if kubeVersion == "" {
+		kubeVersion = schemas.DefaultKubeVersion
+	}
+	sc.SetKubeVersion(kubeVersion)
+	return sc, nil
+}
+
+// SetKubeVersion records the Kubernetes minor version, such as "1.27", that the builtin schemas were taken from.
+// Defaults that the API server of that version applies without declaring them in the schemas are only known once
+// it is set.
+func (sc *SchemaClient) SetKubeVersion(kubeVersion string) {
+	sc.kubeVersion = kubeVersion
+}
+
+func NewSchemaClientFromFS(schemaFS fs.FS) (*SchemaClient, error) {
+	files, err := readSchemaFiles(schemaFS)
+	if err != nil {
+		return nil, err
+	}
+	models, err := parseSchemaFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	return newSchemaClientFromModels(models), nil
+}
+
+// schemaFile is the name and uncompressed content of a schema file.
+type schemaFile struct {
+	name string
+	data []byte
+}
+
+func readSchemaFiles(schemaFS fs.FS) ([]schemaFile, error) {
+	entries, err := fs.ReadDir(schemaFS, ".")
+	if err != nil {
+		return nil, err
+	}
+	files := []schemaFile{}
 	for _, entry := range entries {
 		name := entry.Name()
-		if strings.HasSuffix(name, "_openapi.json") {
-			filePath := path.Join(schemaFolderPath, name)
-			schemaData, err := os.ReadFile(filePath)
+		if strings.HasSuffix(name, schemaFileSuffix) || strings.HasSuffix(name, compressedSchemaFileSuffix) {
+			schemaData, err := readSchemaFile(schemaFS, name)
 			if err != nil {
 				return nil, err
 			}
-			doc, err := openapi_v3.ParseDocument(schemaData)
-			if err != nil {
-				return nil, err
-			}
-			models, err := proto.NewOpenAPIV3Data(doc)
-			if err != nil {
-				return nil, err
+			files = append(files, schemaFile{name, schemaData})
+		}
+	}
+	return files, nil
+}
+
+func parseSchemaFiles(files []schemaFile) ([]proto.Models, error) {
+	result := make([]proto.Models, 0, len(files))
+	for _, file := range files {
+		models, err := parseSchemaModels(file.data)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse schema file '%s': %w", file.name, err)
+		}
+		result = append(result, models)
+	}
+	return result, nil
+}
+
+// newSchemaClientFromModels indexes the models of every schema file by name and GVK. Models declared by
+// several files resolve to the first declaration.
+func newSchemaClientFromModels(fileModels []proto.Models) *SchemaClient {
+	namedSchemas := map[string]*proto.Schema{}
+	gvks := map[schema.GroupVersionKind]*proto.Schema{}
+	for _, models := range fileModels {
+		modelNames := models.ListModels()
+		for _, modelName := range modelNames {
+			modelSchema := models.LookupModel(modelName)
+			if _, ok := namedSchemas[modelName]; !ok {
+				namedSchemas[modelName] = &modelSchema
 			}
-			modelNames := models.ListModels()
-			for _, modelName := range modelNames {
-				modelSchema := models.LookupModel(modelName)
-				modelGvks := parseGVKs(modelSchema)
-				for _, modelGvk := range modelGvks {
-					_, ok := gvks[modelGvk]
-					if !ok {
-						gvks[modelGvk] = &modelSchema
-					}
+			modelGvks := parseGVKs(modelSchema)
+			for _, modelGvk := range modelGvks {
+				_, ok := gvks[modelGvk]
+				if !ok {
+					gvks[modelGvk] = &modelSchema
 				}
 			}
 		}
 	}
-	sc := &SchemaClient{
-		schemas,
-		gvks,
+	return &SchemaClient{
+		schemaNameLookup: namedSchemas,
+		gvkLookup:        gvks,
+		customResources:  map[schema.GroupVersionKind]bool{},
 	}
-	return sc, nil
 }
+
+func parseSchemaModels(schemaData []byte) (proto.Models, error) {
+	schemaData, siblings, err := normalizeSchemaDocument(schemaData)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := openapi_v3.ParseDocument(schemaData)
+	if err != nil {
+		return nil, err
+	}
+	models, err := proto.NewOpenAPIV3Data(doc)
+	if err != nil {
+		return nil, err
+	}
+	applyReferenceSiblings(models, siblings)
+	return models, nil
+}
+
+const (
+	schemaFileSuffix           = "_openapi.json"
+	compressedSchemaFileSuffix = "_openapi.json.gz"
+)
+
+func readSchemaFile(schemaFS fs.FS, name string) ([]byte, error) {
+	if !strings.HasSuffix(name, compressedSchemaFileSuffix) {
+		return fs.ReadFile(schemaFS, name)
+	}
+	f, err := schemaFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	reader, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(reader)
+}
+
 func (sc *SchemaClient) GetPatchMetadata(gvk schema.GroupVersionKind) (k8spatch.LookupPatchMeta, error) {
 	modelSchema, ok := sc.gvkLookup[gvk]
 	if !ok {
-		return nil, fmt.Errorf(fmt.Sprintf("resource schema not found for GVK: %s", gvk.String()))
+		return nil, &SchemaNotFoundError{ResourceLocation{GVK: gvk}}
 	}
-	patchMeta := k8spatch.NewPatchMetaFromOpenAPI(*modelSchema)
-	return patchMeta, nil
+	return newResourcePatchMeta(*modelSchema, sc.schemaNameLookup[objectMetaModelName]), nil
+}
+
+// IsCustomResource reports whether the schema of a kind was registered from a CustomResourceDefinition.
+func (sc *SchemaClient) IsCustomResource(gvk schema.GroupVersionKind) bool {
+	return sc.customResources[gvk]
 }
+
 func (sc *SchemaClient) GetSchemaByGVK(manifest JSONObject) (*proto.Schema, error) {
 	gvk, err := ComputeGVK(manifest)
 	if err != nil {
@@ -73,7 +191,7 @@ func (sc *SchemaClient) GetSchemaByGVK(manifest JSONObject) (*proto.Schema, erro
 	}
 	modelSchema, ok := sc.gvkLookup[*gvk]
 	if !ok {
-		return nil, fmt.Errorf(fmt.Sprintf("resource schema not found for GVK: %s", gvk.String()))
+		return nil, &SchemaNotFoundError{ResourceLocation{GVK: *gvk}}
 	}
 	return modelSchema, nil
 }
@@ -81,7 +199,10 @@ func (sc *SchemaClient) GetSchemaByGVK(manifest JSONObject) (*proto.Schema, erro
 const groupVersionKindExtensionKey = "x-kubernetes-group-version-kind"
 
 func parseGVKs(s proto.Schema) []schema.GroupVersionKind {
-	extensions := s.GetExtensions()
+	return parseGVKExtension(s.GetExtensions())
+}
+
+func parseGVKExtension(extensions map[string]interface{}) []schema.GroupVersionKind {
 	gvkListResult := []schema.GroupVersionKind{}
 	gvkExtension, ok := extensions[groupVersionKindExtensionKey]
 	if !ok {
@@ -0,0 +1,164 @@
+package convert
+
+import (
+	"context"
+	"github.com/amannm/configism/internal/schemas"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8spatch "k8s.io/apimachinery/pkg/util/strategicpatch"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_KubeSchemaClient(t *testing.T) {
+	for _, version := range schemas.KubeVersions() {
+		t.Run(version, func(t *testing.T) {
+			sc, err := NewKubeSchemaClient(version)
+			if err != nil {
+				t.Fatal(err)
+			}
+			patchMeta, err := sc.GetPatchMetadata(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			specMeta, _, err := patchMeta.LookupPatchMetadataForStruct("spec")
+			if err != nil {
+				t.Fatal(err)
+			}
+			templateMeta, _, err := specMeta.LookupPatchMetadataForStruct("template")
+			if err != nil {
+				t.Fatal(err)
+			}
+			podSpecMeta, _, err := templateMeta.LookupPatchMetadataForStruct("spec")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, containersMeta, err := podSpecMeta.LookupPatchMetadataForSlice("containers")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if containersMeta.GetPatchMergeKey() != "name" {
+				t.Fatalf("expected containers to be merged by name, got '%s'", containersMeta.GetPatchMergeKey())
+			}
+		})
+	}
+	_, err := NewKubeSchemaClient("1.0")
+	if err == nil {
+		t.Fatal("expected an error for a Kubernetes version without embedded schemas")
+	}
+}
+
+func Test_WrappedReferenceExtensions(t *testing.T) {
+	bundle, err := schemas.KubeSchemas("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncached, err := NewSchemaClientFromFS(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := NewCachedSchemaClientFromFS(bundle, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		gvk      schema.GroupVersionKind
+		field    string
+		strategy string
+	}{
+		{schema.GroupVersionKind{Group: "policy", Version: "v1", Kind: "PodDisruptionBudget"}, "selector", "replace"},
+		{schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}, "strategy", "retainKeys"},
+	}
+	for _, sc := range []*SchemaClient{uncached, cached} {
+		for _, test := range tests {
+			patchMeta, err := sc.GetPatchMetadata(test.gvk)
+			if err != nil {
+				t.Fatal(err)
+			}
+			specMeta, _, err := patchMeta.LookupPatchMetadataForStruct("spec")
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, fieldMeta, err := specMeta.LookupPatchMetadataForStruct(test.field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			strategies := fieldMeta.GetPatchStrategies()
+			if len(strategies) != 1 || strategies[0] != test.strategy {
+				t.Fatalf("expected %s '%s' to be patched with '%s', got %v", test.gvk.Kind, test.field, test.strategy, strategies)
+			}
+		}
+	}
+
+	manifests := `apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: first
+spec:
+  minAvailable: 1
+  selector:
+    matchLabels:
+      app: web
+      tier: a
+---
+apiVersion: policy/v1
+kind: PodDisruptionBudget
+metadata:
+  name: second
+spec:
+  minAvailable: 1
+  selector:
+    matchLabels:
+      app: web
+      tier: b
+`
+	documents, err := ReadManifestDocuments(strings.NewReader(manifests), "pdb.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	partitions, err := NewPatchGeneratorFromSchemaClient(uncached, PatchGeneratorOptions{}).ExecuteDocuments(context.Background(), documents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, source := range partitions[0].Sources() {
+		expected := documents[i].Object["spec"].(JSONObject)["selector"]
+		if !reflect.DeepEqual(source.Patch()["spec"].(JSONObject)["selector"], expected) {
+			t.Fatalf("expected the patch of '%s' to replace the whole selector, got %v", source.Name(), source.Patch())
+		}
+	}
+	mismatches, err := partitions[0].Verify()
+	if err != nil || len(mismatches) != 0 {
+		t.Fatalf("unexpected verification result: %v %v", mismatches, err)
+	}
+}
+
+func Test_UndeclaredFieldPatchMetadata(t *testing.T) {
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configMap := JSONObject{"apiVersion": "v1", "kind": "ConfigMap"}
+	modelSchema, err := sc.GetSchemaByGVK(configMap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = k8spatch.NewPatchMetaFromOpenAPI(*modelSchema).LookupPatchMetadataForStruct("spec")
+	if err == nil {
+		t.Fatal("expected the upstream patch metadata to reject a field missing from the schema")
+	}
+	patchMeta, err := sc.GetPatchMetadata(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	specMeta, fieldMeta, err := patchMeta.LookupPatchMetadataForStruct("spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(fieldMeta.GetPatchStrategies()) != 0 || fieldMeta.GetPatchMergeKey() != "" {
+		t.Fatalf("expected empty patch metadata for a field missing from the schema, got %v", fieldMeta)
+	}
+	_, _, err = specMeta.LookupPatchMetadataForSlice("items")
+	if err != nil {
+		t.Fatal(err)
+	}
+}
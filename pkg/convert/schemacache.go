@@ -0,0 +1,348 @@
+package convert
+
+import (
+	"crypto/sha256"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// schemaCacheVersion is part of every cache key, and changes whenever the cached form of the schemas does
+const schemaCacheVersion = "configism-schema-cache-v3"
+
+const (
+	cachedKindSchema      = "kind"
+	cachedArraySchema     = "array"
+	cachedMapSchema       = "map"
+	cachedPrimitiveSchema = "primitive"
+	cachedArbitrarySchema = "arbitrary"
+	cachedReferenceSchema = "reference"
+)
+
+// DefaultSchemaCacheDir returns the folder under the user cache directory that compiled schemas are cached in.
+func DefaultSchemaCacheDir() (string, error) {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(cacheDir, "configism", "schemas"), nil
+}
+
+// NewCachedSchemaClientFromFS loads schemas like NewSchemaClientFromFS, reusing the models compiled by an earlier run
+// from cacheDir. Cache entries are keyed by a hash of the schema files, so changed files are compiled again. A cache
+// that cannot be read or written is ignored, and the client is the same whether or not the cache was used.
+func NewCachedSchemaClientFromFS(schemaFS fs.FS, cacheDir string) (*SchemaClient, error) {
+	files, err := readSchemaFiles(schemaFS)
+	if err != nil {
+		return nil, err
+	}
+	cachePath := filepath.Join(cacheDir, schemaCacheKey(files)+".gob")
+	compiled, err := readCompiledSchemas(cachePath)
+	if err == nil {
+		return compiled.schemaClient(), nil
+	}
+	models, err := parseSchemaFiles(files)
+	if err != nil {
+		return nil, err
+	}
+	compiled = compileSchemas(models)
+	_ = writeCompiledSchemas(cachePath, compiled)
+	return compiled.schemaClient(), nil
+}
+
+func schemaCacheKey(files []schemaFile) string {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\n", schemaCacheVersion)
+	for _, file := range files {
+		_, _ = fmt.Fprintf(hash, "%s\n%d\n", file.name, len(file.data))
+		_, _ = hash.Write(file.data)
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// compiledSchemas holds the models of every schema file in the subset of proto.Schema that patch metadata
+// lookups need, along with the GVK index over them.
+type compiledSchemas struct {
+	Files []map[string]*cachedSchema
+	GVKs  []compiledGVK
+}
+
+// compiledGVK locates the model of a GVK by the index of its file and its name within the file.
+type compiledGVK struct {
+	GVK   schema.GroupVersionKind
+	File  int
+	Model string
+}
+
+// cachedSchema is a serializable proto.Schema. References name a model of the same file, which keeps recursive
+// schemas finite. Descriptions and the extensions that patch metadata does not use are dropped, and defaults are
+// kept as JSON.
+type cachedSchema struct {
+	Type       string
+	Extensions cachedExtensions
+	Default    []byte
+	Fields     map[string]*cachedSchema
+	Required   []string
+	SubType    *cachedSchema
+	Reference  string
+	Primitive  string
+	Format     string
+}
+
+type cachedExtensions struct {
+	PatchStrategy string
+	PatchMergeKey string
+	ListType      string
+	ListMapKeys   []string
+	GVKs          []schema.GroupVersionKind
+}
+
+func compileSchemas(fileModels []proto.Models) *compiledSchemas {
+	compiled := &compiledSchemas{}
+	seen := map[schema.GroupVersionKind]bool{}
+	for i, models := range fileModels {
+		file := map[string]*cachedSchema{}
+		for _, modelName := range models.ListModels() {
+			modelSchema := models.LookupModel(modelName)
+			file[modelName] = encodeSchema(modelSchema)
+			for _, gvk := range parseGVKs(modelSchema) {
+				if !seen[gvk] {
+					seen[gvk] = true
+					compiled.GVKs = append(compiled.GVKs, compiledGVK{gvk, i, modelName})
+				}
+			}
+		}
+		compiled.Files = append(compiled.Files, file)
+	}
+	return compiled
+}
+
+func encodeSchema(s proto.Schema) *cachedSchema {
+	if s == nil {
+		return nil
+	}
+	result := &cachedSchema{Extensions: encodeExtensions(s.GetExtensions())}
+	if def := s.GetDefault(); def != nil {
+		result.Default, _ = json.Marshal(def)
+	}
+	switch typed := s.(type) {
+	case proto.Reference:
+		result.Type = cachedReferenceSchema
+		result.Reference = typed.Reference()
+	case *proto.Kind:
+		result.Type = cachedKindSchema
+		result.Required = typed.RequiredFields
+		result.Fields = map[string]*cachedSchema{}
+		for name, field := range typed.Fields {
+			if field != nil {
+				result.Fields[name] = encodeSchema(field)
+			}
+		}
+	case *proto.Array:
+		result.Type = cachedArraySchema
+		result.SubType = encodeSchema(typed.SubType)
+	case *proto.Map:
+		result.Type = cachedMapSchema
+		result.SubType = encodeSchema(typed.SubType)
+	case *proto.Primitive:
+		result.Type = cachedPrimitiveSchema
+		result.Primitive = typed.Type
+		result.Format = typed.Format
+	default:
+		result.Type = cachedArbitrarySchema
+	}
+	return result
+}
+
+func encodeExtensions(extensions map[string]interface{}) cachedExtensions {
+	result := cachedExtensions{}
+	result.PatchStrategy, _ = extensions[patchStrategyExtensionKey].(string)
+	result.PatchMergeKey, _ = extensions[patchMergeKeyExtensionKey].(string)
+	result.ListType, _ = extensions[listTypeExtensionKey].(string)
+	if mapKeys, ok := extensions[listMapKeysExtensionKey].(JSONArray); ok {
+		result.ListMapKeys = []string{}
+		for _, mapKey := range mapKeys {
+			if typedMapKey, ok := mapKey.(string); ok {
+				result.ListMapKeys = append(result.ListMapKeys, typedMapKey)
+			}
+		}
+	}
+	result.GVKs = parseGVKExtension(extensions)
+	return result
+}
+
+// schemaClient rebuilds the models of every file and indexes them like newSchemaClientFromModels.
+func (c *compiledSchemas) schemaClient() *SchemaClient {
+	namedSchemas := map[string]*proto.Schema{}
+	files := make([]*cachedModels, 0, len(c.Files))
+	for _, file := range c.Files {
+		models := &cachedModels{schemas: map[string]proto.Schema{}}
+		for name, cached := range file {
+			models.schemas[name] = models.decodeSchema(cached)
+		}
+		for _, name := range models.ListModels() {
+			if _, ok := namedSchemas[name]; !ok {
+				modelSchema := models.schemas[name]
+				namedSchemas[name] = &modelSchema
+			}
+		}
+		files = append(files, models)
+	}
+	gvks := map[schema.GroupVersionKind]*proto.Schema{}
+	for _, entry := range c.GVKs {
+		if entry.File < 0 || entry.File >= len(files) {
+			continue
+		}
+		if modelSchema, ok := files[entry.File].schemas[entry.Model]; ok {
+			gvks[entry.GVK] = &modelSchema
+		}
+	}
+	return &SchemaClient{
+		schemaNameLookup: namedSchemas,
+		gvkLookup:        gvks,
+		customResources:  map[schema.GroupVersionKind]bool{},
+	}
+}
+
+func (e cachedExtensions) decode() map[string]interface{} {
+	extensions := map[string]interface{}{}
+	if e.PatchStrategy != "" {
+		extensions[patchStrategyExtensionKey] = e.PatchStrategy
+	}
+	if e.PatchMergeKey != "" {
+		extensions[patchMergeKeyExtensionKey] = e.PatchMergeKey
+	}
+	if e.ListType != "" {
+		extensions[listTypeExtensionKey] = e.ListType
+	}
+	if e.ListMapKeys != nil {
+		mapKeys := JSONArray{}
+		for _, mapKey := range e.ListMapKeys {
+			mapKeys = append(mapKeys, mapKey)
+		}
+		extensions[listMapKeysExtensionKey] = mapKeys
+	}
+	if len(e.GVKs) > 0 {
+		gvks := JSONArray{}
+		for _, gvk := range e.GVKs {
+			gvks = append(gvks, JSONObject{"group": gvk.Group, "version": gvk.Version, "kind": gvk.Kind})
+		}
+		extensions[groupVersionKindExtensionKey] = gvks
+	}
+	if len(extensions) == 0 {
+		return nil
+	}
+	return extensions
+}
+
+// cachedModels are the models of a single schema file rebuilt from the cache.
+type cachedModels struct {
+	schemas map[string]proto.Schema
+}
+
+func (m *cachedModels) LookupModel(name string) proto.Schema {
+	return m.schemas[name]
+}
+
+func (m *cachedModels) ListModels() []string {
+	names := make([]string, 0, len(m.schemas))
+	for name := range m.schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *cachedModels) decodeSchema(cached *cachedSchema) proto.Schema {
+	if cached == nil {
+		return nil
+	}
+	base := proto.BaseSchema{Extensions: cached.Extensions.decode()}
+	if cached.Default != nil {
+		_ = json.Unmarshal(cached.Default, &base.Default)
+	}
+	switch cached.Type {
+	case cachedReferenceSchema:
+		return &cachedReference{BaseSchema: base, reference: cached.Reference, models: m}
+	case cachedKindSchema:
+		kind := &proto.Kind{BaseSchema: base, RequiredFields: cached.Required, Fields: map[string]proto.Schema{}}
+		for name, field := range cached.Fields {
+			kind.Fields[name] = m.decodeSchema(field)
+		}
+		return kind
+	case cachedArraySchema:
+		return &proto.Array{BaseSchema: base, SubType: m.decodeSchema(cached.SubType)}
+	case cachedMapSchema:
+		return &proto.Map{BaseSchema: base, SubType: m.decodeSchema(cached.SubType)}
+	case cachedPrimitiveSchema:
+		return &proto.Primitive{BaseSchema: base, Type: cached.Primitive, Format: cached.Format}
+	}
+	return &proto.Arbitrary{BaseSchema: base}
+}
+
+// cachedReference is a proto.Reference to a model of the same file, resolved when it is followed.
+type cachedReference struct {
+	proto.BaseSchema
+	reference string
+	models    *cachedModels
+}
+
+func (r *cachedReference) Accept(v proto.SchemaVisitor) {
+	v.VisitReference(r)
+}
+
+func (r *cachedReference) GetName() string {
+	return fmt.Sprintf("Reference to %q", r.reference)
+}
+
+func (r *cachedReference) Reference() string {
+	return r.reference
+}
+
+func (r *cachedReference) SubSchema() proto.Schema {
+	return r.models.schemas[r.reference]
+}
+
+func readCompiledSchemas(cachePath string) (*compiledSchemas, error) {
+	f, err := os.Open(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = f.Close() }()
+	compiled := &compiledSchemas{}
+	err = gob.NewDecoder(f).Decode(compiled)
+	if err != nil {
+		return nil, err
+	}
+	return compiled, nil
+}
+
+// writeCompiledSchemas writes the cache entry through a temporary file, so that concurrent runs never read a
+// partially written entry.
+func writeCompiledSchemas(cachePath string, compiled *compiledSchemas) error {
+	err := os.MkdirAll(filepath.Dir(cachePath), 0755)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(cachePath), filepath.Base(cachePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	err = gob.NewEncoder(f).Encode(compiled)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), cachePath)
+}
@@ -0,0 +1,91 @@
+package convert
+
+import (
+	"context"
+	"github.com/amannm/configism/internal/schemas"
+	"io/fs"
+	"os"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_CachedSchemaClient(t *testing.T) {
+	inputObjects := []JSONObject{}
+	fileContents, err := ReadAllFiles("./testing", ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fileContent := range fileContents {
+		result, err := ParseYAMLFileIntoJSONObjects(fileContent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		inputObjects = append(inputObjects, result...)
+	}
+	bundle, err := schemas.KubeSchemas("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	uncached, err := NewSchemaClientFromFS(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := decomposeToYAML(t, uncached, inputObjects)
+	cacheDir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		sc, err := NewCachedSchemaClientFromFS(bundle, cacheDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(decomposeToYAML(t, sc, inputObjects), expected) {
+			t.Fatalf("unexpected output from cached schemas on load #%d", i+1)
+		}
+	}
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected a single cache entry, got %d", len(entries))
+	}
+	schemaFS := fstest.MapFS{}
+	for _, entry := range []string{"api__v1_openapi.json.gz", "apis__apps__v1_openapi.json.gz"} {
+		content, err := fs.ReadFile(bundle, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		schemaFS[entry] = &fstest.MapFile{Data: content}
+	}
+	_, err = NewCachedSchemaClientFromFS(schemaFS, cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err = os.ReadDir(cacheDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected changed schema files to be cached separately, got %d entries", len(entries))
+	}
+}
+
+func decomposeToYAML(t *testing.T, sc *SchemaClient, objects []JSONObject) [][]byte {
+	results, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).Execute(context.Background(), objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output := [][]byte{}
+	for _, result := range results {
+		baseYAML, err := result.GetBaseYAML()
+		if err != nil {
+			t.Fatal(err)
+		}
+		patches, err := result.GetPatchYAMLs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		output = append(append(output, baseYAML), patches...)
+	}
+	return output
+}
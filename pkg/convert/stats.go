@@ -0,0 +1,109 @@
+package convert
+
+import "bytes"
+
+// PartitionStats measures the YAML emitted for a partition against the YAML of its original resources.
+type PartitionStats struct {
+	Group         string `json:"group,omitempty"`
+	Version       string `json:"version,omitempty"`
+	Kind          string `json:"kind,omitempty"`
+	Namespace     string `json:"namespace,omitempty"`
+	Sources       int    `json:"sources"`
+	OriginalLines int    `json:"originalLines"`
+	OriginalBytes int    `json:"originalBytes"`
+	BaseLines     int    `json:"baseLines"`
+	BaseBytes     int    `json:"baseBytes"`
+	LayerLines    int    `json:"layerLines"`
+	LayerBytes    int    `json:"layerBytes"`
+	PatchLines    int    `json:"patchLines"`
+	PatchBytes    int    `json:"patchBytes"`
+}
+
+// DecomposedLines returns the number of lines of the base, layers and non-empty patches.
+func (s PartitionStats) DecomposedLines() int {
+	return s.BaseLines + s.LayerLines + s.PatchLines
+}
+
+// DecomposedBytes returns the size in bytes of the base, layers and non-empty patches.
+func (s PartitionStats) DecomposedBytes() int {
+	return s.BaseBytes + s.LayerBytes + s.PatchBytes
+}
+
+// CompressionRatio returns the size of the original resources divided by the size of their decomposition.
+func (s PartitionStats) CompressionRatio() float64 {
+	if s.DecomposedBytes() == 0 {
+		return 0
+	}
+	return float64(s.OriginalBytes) / float64(s.DecomposedBytes())
+}
+
+// Add returns the sum of both stats, keeping only the identifying fields they have in common.
+func (s PartitionStats) Add(other PartitionStats) PartitionStats {
+	result := PartitionStats{
+		Sources:       s.Sources + other.Sources,
+		OriginalLines: s.OriginalLines + other.OriginalLines,
+		OriginalBytes: s.OriginalBytes + other.OriginalBytes,
+		BaseLines:     s.BaseLines + other.BaseLines,
+		BaseBytes:     s.BaseBytes + other.BaseBytes,
+		LayerLines:    s.LayerLines + other.LayerLines,
+		LayerBytes:    s.LayerBytes + other.LayerBytes,
+		PatchLines:    s.PatchLines + other.PatchLines,
+		PatchBytes:    s.PatchBytes + other.PatchBytes,
+	}
+	if s.Group == other.Group && s.Version == other.Version && s.Kind == other.Kind {
+		result.Group, result.Version, result.Kind = s.Group, s.Version, s.Kind
+	}
+	if s.Namespace == other.Namespace {
+		result.Namespace = s.Namespace
+	}
+	return result
+}
+
+// Stats measures the YAML documents of the partition as DumpToFolder writes them.
+func (pgr *PatchPartition) Stats() (PartitionStats, error) {
+	stats := PartitionStats{
+		Group:     pgr.gvk.Group,
+		Version:   pgr.gvk.Version,
+		Kind:      pgr.gvk.Kind,
+		Namespace: pgr.namespace,
+		Sources:   len(pgr.sources),
+	}
+	var err error
+	stats.BaseLines, stats.BaseBytes, err = pgr.measureYAML(pgr.base)
+	if err != nil {
+		return PartitionStats{}, err
+	}
+	for _, layer := range pgr.layers {
+		lines, size, err := pgr.measureYAML(pgr.layerPatch(layer))
+		if err != nil {
+			return PartitionStats{}, err
+		}
+		stats.LayerLines += lines
+		stats.LayerBytes += size
+	}
+	for _, source := range pgr.sources {
+		lines, size, err := pgr.measureYAML(source.original)
+		if err != nil {
+			return PartitionStats{}, err
+		}
+		stats.OriginalLines += lines
+		stats.OriginalBytes += size
+		if patch, ok := pgr.sourcePatch(source); ok {
+			lines, size, err := pgr.measureYAML(patch)
+			if err != nil {
+				return PartitionStats{}, err
+			}
+			stats.PatchLines += lines
+			stats.PatchBytes += size
+		}
+	}
+	return stats, nil
+}
+
+func (pgr *PatchPartition) measureYAML(v any) (int, int, error) {
+	yamlContent, err := pgr.marshalYAML(v)
+	if err != nil {
+		return 0, 0, err
+	}
+	return bytes.Count(yamlContent, []byte("\n")), len(yamlContent), nil
+}
@@ -0,0 +1,75 @@
+package convert
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func Test_PartitionStats(t *testing.T) {
+	fileContents, err := ReadAllFiles("./testing", ".yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	objects := []JSONObject{}
+	for _, fileContent := range fileContents {
+		result, err := ParseYAMLFileIntoJSONObjects(fileContent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects = append(objects, result...)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).Execute(context.Background(), objects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	total := PartitionStats{}
+	for _, result := range results {
+		stats, err := result.Stats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		originalYAMLs, err := result.GetOriginalYAMLs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		baseYAML, err := result.GetBaseYAML()
+		if err != nil {
+			t.Fatal(err)
+		}
+		patches, err := result.GetPatchYAMLs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := PartitionStats{
+			Group:     result.GVK().Group,
+			Version:   result.GVK().Version,
+			Kind:      result.GVK().Kind,
+			Sources:   len(result.Sources()),
+			BaseLines: strings.Count(string(baseYAML), "\n"),
+			BaseBytes: len(baseYAML),
+		}
+		for _, yamlBytes := range originalYAMLs {
+			expected.OriginalLines += strings.Count(string(yamlBytes), "\n")
+			expected.OriginalBytes += len(yamlBytes)
+		}
+		for _, patch := range patches {
+			expected.PatchLines += strings.Count(string(patch), "\n")
+			expected.PatchBytes += len(patch)
+		}
+		if stats != expected {
+			t.Fatalf("unexpected stats for %s: %+v, expected %+v", result.GVK(), stats, expected)
+		}
+		total = total.Add(stats)
+	}
+	if total.Kind != "" || total.Sources != len(objects) {
+		t.Fatalf("unexpected total stats: %+v", total)
+	}
+	if total.CompressionRatio() <= 1 {
+		t.Fatalf("expected the decomposition to be smaller than its input: %+v", total)
+	}
+}
@@ -0,0 +1,95 @@
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// basesFolderName holds the partition bases of a template layout, apart from the mirrored template files
+const basesFolderName = "_bases"
+
+// DumpToTemplateLayout writes the partition bases into `_bases/<partition>/` and mirrors the layout the resources
+// were read from: the patches of every resource rendered from a Helm chart template go into a file at the template
+// path, and those of other resources into a file named after their input file. Each patch document is preceded by
+// comments recording its provenance and the base it applies to. Resources that their base already reproduces have no
+// patch document.
+func DumpToTemplateLayout(partitions []PatchPartition, directoryPath string) error {
+	type templateDocument struct {
+		position SourcePosition
+		content  []byte
+	}
+	templates := map[string][]templateDocument{}
+	for _, partition := range partitions {
+		baseDir := path.Join(basesFolderName, partition.folderName())
+		err := partition.dumpBaseToFolder(path.Join(directoryPath, baseDir))
+		if err != nil {
+			return err
+		}
+		for _, source := range partition.sources {
+			patch, ok := partition.sourcePatch(source)
+			if !ok {
+				continue
+			}
+			yamlContent, err := partition.marshalYAML(patch)
+			if err != nil {
+				return err
+			}
+			content := bytes.Buffer{}
+			content.Write(source.provenance.header())
+			content.WriteString(fmt.Sprintf("# Base: %s\n", baseDir))
+			if source.layer != "" {
+				content.WriteString(fmt.Sprintf("# Layer: %s\n", source.layer))
+			}
+			content.Write(yamlContent)
+			templatePath := source.templatePath(partition.folderName())
+			templates[templatePath] = append(templates[templatePath], templateDocument{source.provenance.Position, content.Bytes()})
+		}
+	}
+	for templatePath, documents := range templates {
+		sort.SliceStable(documents, func(i, j int) bool {
+			if documents[i].position.File != documents[j].position.File {
+				return documents[i].position.File < documents[j].position.File
+			}
+			return documents[i].position.Document < documents[j].position.Document
+		})
+		filePath := path.Join(directoryPath, templatePath)
+		err := os.MkdirAll(path.Dir(filePath), 0755)
+		if err != nil {
+			return err
+		}
+		content := bytes.Buffer{}
+		for _, document := range documents {
+			content.WriteString("---\n")
+			content.Write(document.content)
+		}
+		err = WriteFile(content.Bytes(), filePath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// templatePath returns the path of the file mirroring the template or input file the resource was read from,
+// relative to the layout root.
+func (ps PatchSource) templatePath(folderName string) string {
+	if template := ps.provenance.Template(); isRelativePath(template) {
+		return template
+	}
+	if file := path.Clean(ps.provenance.Position.File); isRelativePath(file) && file != StdinFileName {
+		return file
+	}
+	if file := ps.provenance.Position.File; file != "" && file != StdinFileName {
+		return path.Base(file)
+	}
+	return path.Join(folderName, fmt.Sprintf("%s.yaml", ps.identity.fileStem()))
+}
+
+// isRelativePath reports whether p is a non-empty path that stays within the directory it is relative to.
+func isRelativePath(p string) bool {
+	return p != "" && p != "." && !path.IsAbs(p) && p != ".." && !strings.HasPrefix(p, "../")
+}
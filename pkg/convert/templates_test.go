@@ -0,0 +1,96 @@
+package convert
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func Test_DumpToTemplateLayout(t *testing.T) {
+	documents, err := ReadManifestDocuments(strings.NewReader(input), "rendered.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{}).ExecuteDocuments(context.Background(), documents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	templates := []string{}
+	for _, source := range results[0].Sources() {
+		templates = append(templates, source.Provenance().Template())
+	}
+	expectedTemplates := []string{
+		"cert-manager/templates/cainjector-deployment.yaml",
+		"cert-manager/templates/deployment.yaml",
+		"cert-manager/templates/webhook-deployment.yaml",
+	}
+	if strings.Join(templates, ",") != strings.Join(expectedTemplates, ",") {
+		t.Fatalf("unexpected templates: %v", templates)
+	}
+	outputDir := t.TempDir()
+	err = DumpToTemplateLayout(results, outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(path.Join(outputDir, basesFolderName, results[0].folderName(), "base.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := os.ReadFile(path.Join(outputDir, "cert-manager/templates/webhook-deployment.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedHeader := "---\n# Source: cert-manager/templates/webhook-deployment.yaml\n# Input: rendered.yaml:109 (document 3)\n# Base: _bases/apps_v1_Deployment\n"
+	if !strings.HasPrefix(string(content), expectedHeader) || !strings.Contains(string(content), "name: cert-manager-webhook") {
+		t.Fatalf("unexpected template content:\n%s", content)
+	}
+
+	documents, err = ReadManifestDocuments(strings.NewReader(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: a
+data:
+  level: info
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: settings
+  namespace: b
+data:
+  level: info
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+  namespace: a
+data:
+  level: info
+`), "configs.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{BaseThreshold: 50}).ExecuteDocuments(context.Background(), documents)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = DumpToTemplateLayout(results, outputDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err = os.ReadFile(path.Join(outputDir, "configs.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(content), "---\n") != 2 || strings.Contains(string(content), "(document 1)") || strings.Contains(string(content), "{}") {
+		t.Fatalf("expected no document for the resource its base reproduces:\n%s", content)
+	}
+}
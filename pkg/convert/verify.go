@@ -0,0 +1,127 @@
+package convert
+
+import (
+	"fmt"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"reflect"
+	"sort"
+)
+
+// Difference is a value at a path of the original resource that the reapplied patch does not reproduce. A field or
+// list item present on one side only is marked absent on the other, which tells it apart from an explicit null.
+type Difference struct {
+	Path           string
+	Expected       JSONValue
+	Actual         JSONValue
+	ExpectedAbsent bool
+	ActualAbsent   bool
+}
+
+type SourceMismatch struct {
+	GVK         schema.GroupVersionKind
+	Name        string
+	Position    SourcePosition
+	Differences []Difference
+}
+
+// Verify reapplies every source patch onto the partition base and reports each source whose
+// result does not reproduce its original resource exactly.
+func (pgr *PatchPartition) Verify() ([]SourceMismatch, error) {
+	mismatches := []SourceMismatch{}
+	for _, source := range pgr.sources {
+		reapplied, err := pgr.applySourcePatch(source)
+		if err != nil {
+			return nil, fmt.Errorf("unable to apply patch for %s %s: %w", pgr.gvk.Kind, source.describe(), err)
+		}
+		differences := diffJSON("", source.original, reapplied)
+		if len(differences) > 0 {
+			mismatches = append(mismatches, SourceMismatch{
+				GVK:         pgr.gvk,
+				Name:        source.identity.QualifiedName(),
+				Position:    source.provenance.Position,
+				Differences: differences,
+			})
+		}
+	}
+	return mismatches, nil
+}
+
+func diffJSON(path string, expected JSONValue, actual JSONValue) []Difference {
+	switch typedExpected := expected.(type) {
+	case JSONObject:
+		if typedActual, ok := actual.(JSONObject); ok {
+			return diffJSONObject(path, typedExpected, typedActual)
+		}
+	case JSONArray:
+		if typedActual, ok := actual.(JSONArray); ok {
+			return diffJSONArray(path, typedExpected, typedActual)
+		}
+	}
+	if reflect.DeepEqual(expected, actual) {
+		return nil
+	}
+	return []Difference{{
+		Path:     path,
+		Expected: expected,
+		Actual:   actual,
+	}}
+}
+
+func diffJSONObject(path string, expected JSONObject, actual JSONObject) []Difference {
+	keys := map[string]struct{}{}
+	for k := range expected {
+		keys[k] = struct{}{}
+	}
+	for k := range actual {
+		keys[k] = struct{}{}
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for k := range keys {
+		sortedKeys = append(sortedKeys, k)
+	}
+	sort.Strings(sortedKeys)
+	result := []Difference{}
+	for _, k := range sortedKeys {
+		expectedValue, expectedOk := expected[k]
+		actualValue, actualOk := actual[k]
+		if expectedOk != actualOk {
+			result = append(result, Difference{
+				Path:           appendFieldPath(path, k),
+				Expected:       expectedValue,
+				Actual:         actualValue,
+				ExpectedAbsent: !expectedOk,
+				ActualAbsent:   !actualOk,
+			})
+			continue
+		}
+		result = append(result, diffJSON(appendFieldPath(path, k), expectedValue, actualValue)...)
+	}
+	return result
+}
+
+func diffJSONArray(path string, expected JSONArray, actual JSONArray) []Difference {
+	result := []Difference{}
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		if i >= len(expected) || i >= len(actual) {
+			difference := Difference{Path: appendIndexPath(path, i), ExpectedAbsent: i >= len(expected), ActualAbsent: i >= len(actual)}
+			if !difference.ExpectedAbsent {
+				difference.Expected = expected[i]
+			}
+			if !difference.ActualAbsent {
+				difference.Actual = actual[i]
+			}
+			result = append(result, difference)
+			continue
+		}
+		result = append(result, diffJSON(appendIndexPath(path, i), expected[i], actual[i])...)
+	}
+	return result
+}
+
+func appendFieldPath(path string, key string) string {
+	return fmt.Sprintf("%s.%s", path, key)
+}
+
+func appendIndexPath(path string, index int) string {
+	return fmt.Sprintf("%s[%d]", path, index)
+}
@@ -0,0 +1,56 @@
+package convert
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_Verify(t *testing.T) {
+	partition := PatchPartition{
+		base: JSONObject{"kind": "Example", "spec": JSONObject{"replicas": 1.0}},
+		sources: []PatchSource{
+			{
+				identity: ResourceIdentity{Kind: "Example", Name: "good"},
+				original: JSONObject{"kind": "Example", "spec": JSONObject{"replicas": 1.0, "paused": true}},
+				patch:    JSONObject{"spec": JSONObject{"paused": true}},
+			},
+			{
+				identity: ResourceIdentity{Kind: "Example", Name: "bad"},
+				original: JSONObject{"kind": "Example", "spec": JSONObject{"replicas": 2.0}},
+				patch:    JSONObject{"spec": JSONObject{"replicas": 3.0}},
+			},
+		},
+		patchMeta: newSchemaPatchMeta(nil),
+	}
+	mismatches, err := partition.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SourceMismatch{{
+		Name:        "bad",
+		Differences: []Difference{{Path: ".spec.replicas", Expected: 2.0, Actual: 3.0}},
+	}}
+	if !reflect.DeepEqual(mismatches, expected) {
+		t.Fatalf("unexpected mismatches: %v", mismatches)
+	}
+
+	partition.sources = []PatchSource{{
+		identity: ResourceIdentity{Kind: "Example", Name: "null"},
+		original: JSONObject{"kind": "Example", "spec": JSONObject{"replicas": 1.0, "paused": nil}, "items": JSONArray{"a", nil}},
+		patch:    JSONObject{"items": JSONArray{"a"}},
+	}}
+	mismatches, err = partition.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []SourceMismatch{{
+		Name: "null",
+		Differences: []Difference{
+			{Path: ".items[1]", ActualAbsent: true},
+			{Path: ".spec.paused", ActualAbsent: true},
+		},
+	}}
+	if !reflect.DeepEqual(mismatches, expected) {
+		t.Fatalf("expected explicit nulls to differ from absent values: %v", mismatches)
+	}
+}
@@ -0,0 +1,48 @@
+package convert
+
+import (
+	"context"
+	"runtime"
+	"sync"
+)
+
+// workerPool bounds the number of goroutines working on a run. The goroutine that starts the run counts as one of the
+// workers: work that finds no free worker runs on the calling goroutine instead of waiting, so that work submitted
+// from within the pool cannot deadlock it, and only the other workers get a goroutine of their own.
+type workerPool struct {
+	tokens chan struct{}
+}
+
+// newWorkerPool returns a pool of the given number of workers, or of runtime.GOMAXPROCS workers when not positive.
+func newWorkerPool(workers int) *workerPool {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &workerPool{tokens: make(chan struct{}, workers-1)}
+}
+
+// forEach calls fn for every index in [0, n) and returns the error of each call by index. Calls that have not
+// started by the time ctx is done are skipped and report ctx.Err().
+func (p *workerPool) forEach(ctx context.Context, n int, fn func(int) error) []error {
+	errs := make([]error, n)
+	wg := sync.WaitGroup{}
+	for i := 0; i < n; i++ {
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
+		select {
+		case p.tokens <- struct{}{}:
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-p.tokens }()
+				errs[i] = fn(i)
+			}(i)
+		default:
+			errs[i] = fn(i)
+		}
+	}
+	wg.Wait()
+	return errs
+}
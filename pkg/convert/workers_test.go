@@ -0,0 +1,77 @@
+package convert
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_ExecuteWorkers(t *testing.T) {
+	inputObjects, err := ParseYAMLFileIntoJSONObjects([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc, err := NewKubeSchemaClient("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := [][][]byte{}
+	for _, workers := range []int{1, 8} {
+		results, err := NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{Workers: workers, LayerSimilarity: 0.5, FallbackToMergePatch: true}).Execute(context.Background(), inputObjects)
+		if err != nil {
+			t.Fatal(err)
+		}
+		output := [][]byte{}
+		for _, result := range results {
+			baseYAML, err := result.GetBaseYAML()
+			if err != nil {
+				t.Fatal(err)
+			}
+			patches, err := result.GetPatchYAMLs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			output = append(append(output, baseYAML), patches...)
+		}
+		outputs = append(outputs, output)
+	}
+	if !reflect.DeepEqual(outputs[0], outputs[1]) {
+		t.Fatal("expected the same output regardless of the number of workers")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = NewPatchGeneratorFromSchemaClient(sc, PatchGeneratorOptions{FallbackToMergePatch: true}).Execute(ctx, inputObjects)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the run to be cancelled, got %v", err)
+	}
+}
+
+func Test_WorkerPoolBound(t *testing.T) {
+	for _, workers := range []int{1, 3} {
+		pool := newWorkerPool(workers)
+		active := int32(0)
+		peak := int32(0)
+		work := func(int) error {
+			current := atomic.AddInt32(&active, 1)
+			defer atomic.AddInt32(&active, -1)
+			for {
+				seen := atomic.LoadInt32(&peak)
+				if current <= seen || atomic.CompareAndSwapInt32(&peak, seen, current) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			return nil
+		}
+		pool.forEach(context.Background(), 8, func(i int) error {
+			pool.forEach(context.Background(), 8, work)
+			return nil
+		})
+		if peak > int32(workers) {
+			t.Fatalf("expected at most %d concurrent calls, got %d", workers, peak)
+		}
+	}
+}